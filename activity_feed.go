@@ -0,0 +1,443 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"encoding/json"
+	"encoding/xml"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActivityFeed is a read-only Atom feed of a project's recent activity,
+// read with its token instead of a login so people without an account can
+// follow the project in a feed reader.
+type ActivityFeed struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Token string `json:"token"`
+	URL string `json:"url"`
+	CreatedBy *int64 `json:"created-by"`
+}
+
+type ActivityFeeds []ActivityFeed
+
+// ActivityItem is an entry of a project's activity. Kind is created, moved,
+// assigned or commented. Moves carry the old and new status in Previous and
+// Detail, assignments the assignee's name in Detail and comments their body.
+type ActivityItem struct {
+	Kind string
+	Id int64
+	TaskId int64
+	TaskName string
+	At time.Time
+	ActorName string
+	Previous string
+	Detail string
+}
+
+// activityFeedSize is how many entries a feed shows.
+const activityFeedSize = 50
+
+type atomFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Title string `xml:"title"`
+	Id string `xml:"id"`
+	Updated string `xml:"updated"`
+	Links []atomLink `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel string `xml:"rel,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	Id string `xml:"id"`
+	Updated string `xml:"updated"`
+	Author atomPerson `xml:"author"`
+	Link atomLink `xml:"link"`
+	Content *atomText `xml:"content,omitempty"`
+}
+
+func activityFeedURL(token string) (string) {
+	return strings.TrimRight(config.Mail.BaseURL, "/") + "/activity.atom?" + url.Values{"token": {token}}.Encode()
+}
+
+// projectLink opens a project's board.
+func projectLink(projectId int64, projectName string) (string) {
+	q := url.Values{
+		"projectid": {strconv.FormatInt(projectId, 10)},
+		"projectname": {projectName},
+	}
+	return strings.TrimRight(config.Mail.BaseURL, "/") + "/tasks?" + q.Encode()
+}
+
+func atomTime(t time.Time) (string) {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// atomEntryFor describes an activity item. Entry ids are built from the row
+// the item comes from, so readers never show an item twice.
+func atomEntryFor(item *ActivityItem, link string) (atomEntry) {
+	actor := item.ActorName
+	if actor == "" {
+		actor = "Someone"
+	}
+
+	var title string
+	var content *atomText
+
+	switch item.Kind {
+	case "created":
+		title = actor + " created " + item.TaskName
+	case "moved":
+		title = actor + " moved " + item.TaskName + " from " + item.Previous + " to " + item.Detail
+		if item.Previous == "" {
+			title = actor + " moved " + item.TaskName + " to " + item.Detail
+		}
+	case "assigned":
+		title = actor + " assigned " + item.TaskName + " to " + item.Detail
+		if item.Detail == "" {
+			title = actor + " assigned " + item.TaskName
+		}
+	case "commented":
+		title = actor + " commented on " + item.TaskName
+		content = &atomText{Type: "text", Body: item.Detail}
+	}
+
+	return atomEntry{
+		Title: title,
+		Id: "urn:kanelm:" + item.Kind + ":" + strconv.FormatInt(item.Id, 10),
+		Updated: atomTime(item.At),
+		Author: atomPerson{Name: actor},
+		Link: atomLink{Href: link},
+		Content: content,
+	}
+}
+
+// writeAtom renders a project's activity, newest first, as an Atom feed.
+func writeAtom(w io.Writer, projectId int64, projectName string, selfURL string, items []ActivityItem, now time.Time) (error) {
+	link := projectLink(projectId, projectName)
+
+	feed := atomFeed{
+		Title: projectName + " activity",
+		Id: "urn:kanelm:project:" + strconv.FormatInt(projectId, 10),
+		Updated: atomTime(now),
+		Links: []atomLink{{Href: link}, {Href: selfURL, Rel: "self"}},
+		Entries: make([]atomEntry, 0, len(items)),
+	}
+
+	if len(items) > 0 {
+		feed.Updated = atomTime(items[0].At)
+	}
+
+	for i := range items {
+		feed.Entries = append(feed.Entries, atomEntryFor(&items[i], link))
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(&feed)
+}
+
+func scanActivityFeed(row rowScanner) (ActivityFeed, error) {
+	feed := ActivityFeed{}
+	var createdBy sql.NullInt64
+
+	err := row.Scan(&feed.Id, &feed.ProjectId, &feed.Token, &createdBy)
+	if err != nil {
+		return feed, err
+	}
+
+	if createdBy.Valid {
+		id := createdBy.Int64
+		feed.CreatedBy = &id
+	}
+
+	feed.URL = activityFeedURL(feed.Token)
+
+	return feed, nil
+}
+
+var getActivityFeedQuery *sql.Stmt = prepareQuery("sql/get_activity_feed.sql")
+
+// newActivityFeedHandler makes a feed of a project's activity. The feed
+// shows the project to anyone with its link, so only the people who manage
+// the project can make one.
+func newActivityFeedHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_activity_feed.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var feed ActivityFeed
+
+		err := json.NewDecoder(r.Body).Decode(&feed)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "project",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &feed.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		feed.Token, err = randomToken()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = stmt.QueryRow(feed.ProjectId, feed.Token, auId).Scan(&feed.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		feed.URL = activityFeedURL(feed.Token)
+		feed.CreatedBy = &auId
+
+		json.NewEncoder(w).Encode(&feed)
+	}
+}
+
+func deleteActivityFeedHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_activity_feed.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		feed, err := scanActivityFeed(getActivityFeedQuery.QueryRow(id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Activity feed does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "project",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &feed.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(id)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+// getProjectActivityFeedsHandler lists a project's feeds with their tokens,
+// so it is limited to the people who manage the project.
+func getProjectActivityFeedsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_activity_feeds.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		projectId, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "project",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		rows, err := db.Query(query, projectId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		feeds := make(ActivityFeeds, 0)
+
+		for rows.Next() {
+			feed, err := scanActivityFeed(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			feeds = append(feeds, feed)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&feeds)
+	}
+}
+
+// activityFeedHandler serves the feed of the token in the query, built from
+// the task events, task creations and comments of its project. It needs no
+// login, the token is the secret.
+func activityFeedHandler() func(http.ResponseWriter, *http.Request) {
+
+	projectQuery := loadQuery("sql/get_activity_feed_project.sql")
+	activityQuery := loadQuery("sql/get_project_activity.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "Activity feed does not exist", 404)
+			return
+		}
+
+		var projectId int64
+		var projectName string
+
+		err := db.QueryRow(projectQuery, token).Scan(&projectId, &projectName)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Activity feed does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(activityQuery, projectId, activityFeedSize)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		items := make([]ActivityItem, 0)
+
+		for rows.Next() {
+			var item ActivityItem
+			var actorName, previous, detail sql.NullString
+
+			err := rows.Scan(&item.Kind, &item.Id, &item.TaskId, &item.TaskName, &item.At, &actorName, &previous, &detail)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			item.ActorName = actorName.String
+			item.Previous = previous.String
+			item.Detail = detail.String
+
+			items = append(items, item)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Header().Set("Cache-Control", "private, max-age=300")
+
+		writeAtom(w, projectId, projectName, activityFeedURL(token), items, time.Now())
+	}
+}
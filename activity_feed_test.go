@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteAtom(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	items := []ActivityItem{
+		{Kind: "commented", Id: 7, TaskId: 3, TaskName: "Docs", At: at, ActorName: "shiba", Detail: "Looks <good>"},
+		{Kind: "moved", Id: 12, TaskId: 3, TaskName: "Docs", At: at.Add(-time.Hour), ActorName: "shiba", Previous: "Todo", Detail: "Done"},
+		{Kind: "assigned", Id: 11, TaskId: 3, TaskName: "Docs", At: at.Add(-2 * time.Hour), Detail: "akita"},
+		{Kind: "created", Id: 3, TaskId: 3, TaskName: "Docs", At: at.Add(-3 * time.Hour), ActorName: "shiba"},
+	}
+
+	var b bytes.Buffer
+	err := writeAtom(&b, 1, "Kanelm", "http://localhost:8080/activity.atom?token=t", items, at.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feed atomFeed
+	err = xml.Unmarshal(b.Bytes(), &feed)
+	if err != nil {
+		t.Fatalf("feed is not valid xml: %s\n%s", err, b.String())
+	}
+
+	if feed.Updated != "2026-10-19T09:00:00Z" {
+		t.Errorf("feed updated = %s, want the newest entry", feed.Updated)
+	}
+
+	titles := []string{
+		"shiba commented on Docs",
+		"shiba moved Docs from Todo to Done",
+		"Someone assigned Docs to akita",
+		"shiba created Docs",
+	}
+
+	if len(feed.Entries) != len(titles) {
+		t.Fatalf("%d entries, want %d", len(feed.Entries), len(titles))
+	}
+
+	for i, title := range titles {
+		if feed.Entries[i].Title != title {
+			t.Errorf("entry %d title = %q, want %q", i, feed.Entries[i].Title, title)
+		}
+	}
+
+	if feed.Entries[0].Content == nil || feed.Entries[0].Content.Body != "Looks <good>" {
+		t.Error("comment body was not kept")
+	}
+
+	if feed.Entries[1].Id != "urn:kanelm:moved:12" {
+		t.Errorf("entry id = %s", feed.Entries[1].Id)
+	}
+
+	if !strings.Contains(b.String(), `xmlns="http://www.w3.org/2005/Atom"`) {
+		t.Error("feed is missing the Atom namespace")
+	}
+}
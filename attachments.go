@@ -0,0 +1,403 @@
+package main
+
+import (
+	"log"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"encoding/json"
+	"encoding/hex"
+	"crypto/rand"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Attachment struct {
+	Id int64 `json:"id"`
+	TaskId int64 `json:"task-id"`
+	UploadedBy int64 `json:"uploaded-by"`
+	Filename string `json:"filename"`
+	ContentType string `json:"content-type"`
+	Size int64 `json:"size"`
+	StorageKey string `json:"-"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type Attachments []Attachment
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// allowedContentType matches a detected content type against the configured
+// list, where an entry like image/* allows the whole family.
+func allowedContentType(contentType string, allowed []string) (bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		if strings.HasSuffix(a, "/*") {
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")) {
+				return true
+			}
+			continue
+		}
+
+		if mediaType == a {
+			return true
+		}
+	}
+
+	return false
+}
+
+func attachmentFilename(name string) (string) {
+	name = filepath.Base(strings.Replace(name, "\\", "/", -1))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	return name
+}
+
+var getAttachmentQuery *sql.Stmt = prepareQuery("sql/get_attachment.sql")
+
+func getAttachment(id int64) (*Attachment, error) {
+	a := &Attachment{}
+	err := getAttachmentQuery.QueryRow(id).Scan(&a.Id, &a.TaskId, &a.UploadedBy, &a.Filename, &a.ContentType, &a.Size, &a.StorageKey, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func newAttachmentHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_attachment.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		maxSize := config.Attachments.MaxSize
+
+		// Leave room for the multipart boundaries and form fields around the file.
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize + 1<<20)
+
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		defer r.MultipartForm.RemoveAll()
+
+		taskId, err := strconv.ParseInt(r.FormValue("taskid"), 10, 64)
+		if err != nil {
+			http.Error(w, "taskid form field is unavailable", 400)
+			return
+		}
+
+		var projectId int64
+		err = taskProjectQuery.QueryRow(taskId).Scan(&projectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "attachment",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+			TaskId: &taskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file form field is unavailable", 400)
+			return
+		}
+
+		defer file.Close()
+
+		if header.Size > maxSize {
+			http.Error(w, fmt.Sprintf("Attachment is larger than %d bytes", maxSize), 413)
+			return
+		}
+
+		sniff := make([]byte, 512)
+		n, err := io.ReadFull(file, sniff)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		contentType := http.DetectContentType(sniff[:n])
+		if !allowedContentType(contentType, config.Attachments.AllowedTypes) {
+			http.Error(w, "Attachment type " + contentType + " is not allowed", 415)
+			return
+		}
+
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		token, err := randomToken()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		a := &Attachment{
+			TaskId: taskId,
+			UploadedBy: auId,
+			Filename: attachmentFilename(header.Filename),
+			ContentType: contentType,
+			Size: header.Size,
+			StorageKey: fmt.Sprintf("tasks/%d/%s", taskId, token),
+		}
+
+		err = blobs.Put(a.StorageKey, file, a.Size, a.ContentType)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = stmt.QueryRow(a.TaskId, a.UploadedBy, a.Filename, a.ContentType, a.Size, a.StorageKey).Scan(&a.Id, &a.CreatedAt)
+		if err != nil {
+			blobs.Delete(a.StorageKey)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(a)
+	}
+}
+
+func getTaskAttachmentsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_task_attachments.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		attachments := make(Attachments, 0)
+
+		for rows.Next() {
+			a := Attachment{}
+
+			err := rows.Scan(&a.Id, &a.TaskId, &a.UploadedBy, &a.Filename, &a.ContentType, &a.Size, &a.StorageKey, &a.CreatedAt)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			attachments = append(attachments, a)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&attachments)
+	}
+}
+
+func downloadAttachmentHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["id"] == nil {
+			http.Error(w, "id param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["id"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		a, err := getAttachment(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		blob, err := blobs.Get(a.StorageKey)
+		if err == ErrBlobNotFound {
+			http.Error(w, "Attachment contents are missing", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer blob.Close()
+
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		io.Copy(w, blob)
+	}
+}
+
+func deleteAttachmentHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_attachment.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		attachmentId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		a, err := getAttachment(attachmentId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		var projectId int64
+		err = taskProjectQuery.QueryRow(a.TaskId).Scan(&projectId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "attachment",
+			Action: "delete",
+			ActiveUserId: auId,
+			UserId: &a.UploadedBy,
+			ProjectId: &projectId,
+			TaskId: &a.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(attachmentId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		err = blobs.Delete(a.StorageKey)
+		if err != nil {
+			log.Println("Failed to delete attachment blob " + a.StorageKey + ": " + err.Error())
+		}
+	}
+}
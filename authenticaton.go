@@ -21,14 +21,16 @@ func (a AuthCache) Delete(token string) {
 	delete(a, token)
 }
 
+// scheduler runs the background jobs of the server. Jobs are added before
+// it is started in main.
+var scheduler *cron.Cron = cron.New()
+
 func (a AuthCache) GarbageCollector() {
-	c := cron.New()
-	c.AddFunc("@every 1h30m", func() {
+	scheduler.AddFunc("@every 1h30m", func() {
 		for token, user := range a {
 			if user.Expired() {
 				a.Delete(token)
 			}
 		}
 	})
-	c.Start()
 }
@@ -0,0 +1,1186 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule automates a step people repeat on a project's tasks: when Trigger
+// happens to a task and every condition holds, the actions run as the user
+// who made the rule, once the change that triggered it is committed.
+type Rule struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Trigger RuleTrigger `json:"trigger"`
+	Conditions []RuleCondition `json:"conditions"`
+	Actions []RuleAction `json:"actions"`
+	Active *bool `json:"active"`
+	CreatedBy int64 `json:"created-by"`
+}
+
+type Rules []Rule
+
+// RuleTrigger is what a rule waits for, one of ruleTriggers. Status narrows
+// status-changed to moves into that status, LabelId narrows label-added to
+// that label and UserId narrows assigned to that user. due-date-passed fires
+// once for each due date a task misses, counting due dates after the rule
+// was made.
+type RuleTrigger struct {
+	Type string `json:"type"`
+	Status string `json:"status,omitempty"`
+	LabelId *int64 `json:"label-id,omitempty"`
+	UserId *int64 `json:"user-id,omitempty"`
+}
+
+var ruleTriggers = toSet([]string{"status-changed", "label-added", "assigned", "due-date-passed"})
+
+// RuleCondition checks the task when its rule fires. Status and priority are
+// compared to Value with is or is-not. Label and assignee are checked with
+// has or has-not for the label or user Id, or any when Id is left out.
+type RuleCondition struct {
+	Field string `json:"field"`
+	Op string `json:"op"`
+	Value string `json:"value,omitempty"`
+	Id *int64 `json:"id,omitempty"`
+}
+
+// RuleAction is one step of a rule, one of ruleActions: set-status to
+// Status, assign UserId, unassign UserId or everyone when it is left out,
+// add-label LabelId, comment Body, or fire-webhook, which queues a rule.fired
+// delivery to WebhookId.
+type RuleAction struct {
+	Type string `json:"type"`
+	Status string `json:"status,omitempty"`
+	UserId *int64 `json:"user-id,omitempty"`
+	LabelId *int64 `json:"label-id,omitempty"`
+	Body string `json:"body,omitempty"`
+	WebhookId *int64 `json:"webhook-id,omitempty"`
+}
+
+var ruleActions = toSet([]string{"set-status", "assign", "unassign", "add-label", "comment", "fire-webhook"})
+
+// RuleRun is an entry of a rule's execution log. Status is success, failed
+// or skipped, when loop protection stopped the rule. Changes lists what the
+// actions changed.
+type RuleRun struct {
+	Id int64 `json:"id"`
+	RuleId int64 `json:"rule-id"`
+	TaskId int64 `json:"task-id"`
+	Event string `json:"event"`
+	Status string `json:"status"`
+	Changes json.RawMessage `json:"changes"`
+	Error string `json:"error"`
+	DueAt *time.Time `json:"due-at"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type RuleRuns []RuleRun
+
+type RuleRunPage struct {
+	Runs RuleRuns `json:"runs"`
+	Total int64 `json:"total"`
+	Limit int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+// maxRuleChain is how many rules may fire in a row, each on the changes of
+// the one before, before the next is skipped.
+const maxRuleChain = 5
+
+// ruleTask is what conditions are checked against.
+type ruleTask struct {
+	Status string
+	Priority string
+	Closed bool
+	Labels []int64
+	Assignees []int64
+}
+
+func containsId(ids []int64, id int64) (bool) {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeId(ids []int64, id int64) ([]int64) {
+	kept := make([]int64, 0, len(ids))
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+func (c *RuleCondition) holds(t *ruleTask) (bool) {
+	switch c.Field {
+	case "status":
+		return (t.Status == c.Value) == (c.Op == "is")
+	case "priority":
+		return (t.Priority == c.Value) == (c.Op == "is")
+	}
+
+	ids := t.Labels
+	if c.Field == "assignee" {
+		ids = t.Assignees
+	}
+
+	has := len(ids) > 0
+	if c.Id != nil {
+		has = containsId(ids, *c.Id)
+	}
+
+	return has == (c.Op == "has")
+}
+
+func (r *Rule) holds(t *ruleTask) (bool) {
+	for i := range r.Conditions {
+		if !r.Conditions[i].holds(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleTrigger names the trigger an event is, if any, and the value its
+// filter is compared to.
+func ruleTrigger(e *Event) (string, interface{}) {
+	if e.TaskId == nil {
+		return "", nil
+	}
+
+	switch data := e.Data.(type) {
+	case *TaskAssignee:
+		if e.Type == "task.assigned" {
+			return "assigned", data.UserId
+		}
+	case *Change:
+		if e.Type != "task.updated" {
+			break
+		}
+
+		switch data.Field {
+		case "status":
+			return "status-changed", data.Value
+		case "label-added":
+			return "label-added", data.Value
+		}
+	}
+
+	return "", nil
+}
+
+func (tr *RuleTrigger) matches(value interface{}) (bool) {
+	switch tr.Type {
+	case "status-changed":
+		return tr.Status == "" || value == tr.Status
+	case "label-added":
+		return tr.LabelId == nil || value == *tr.LabelId
+	case "assigned":
+		return tr.UserId == nil || value == *tr.UserId
+	}
+	return false
+}
+
+func validRule(r *Rule) (bool, string) {
+	if strings.TrimSpace(r.Name) == "" {
+		return false, "Rule name can not be empty"
+	}
+
+	if !ruleTriggers.Has(r.Trigger.Type) {
+		return false, "Unknown trigger " + r.Trigger.Type
+	}
+
+	if r.Trigger.Status != "" && !toSet(boardColumns).Has(r.Trigger.Status) {
+		return false, "Unknown status " + r.Trigger.Status
+	}
+
+	for _, c := range r.Conditions {
+		switch c.Field {
+		case "status", "priority":
+			if c.Op != "is" && c.Op != "is-not" {
+				return false, c.Field + " conditions must use is or is-not"
+			}
+		case "label", "assignee":
+			if c.Op != "has" && c.Op != "has-not" {
+				return false, c.Field + " conditions must use has or has-not"
+			}
+		default:
+			return false, "Unknown condition field " + c.Field
+		}
+	}
+
+	if len(r.Actions) == 0 {
+		return false, "A rule needs at least one action"
+	}
+
+	for _, a := range r.Actions {
+		if !ruleActions.Has(a.Type) {
+			return false, "Unknown action " + a.Type
+		}
+
+		switch {
+		case a.Type == "set-status" && !toSet(boardColumns).Has(a.Status):
+			return false, "set-status needs a status, one of " + strings.Join(boardColumns, ", ")
+		case a.Type == "assign" && a.UserId == nil:
+			return false, "assign needs a user-id"
+		case a.Type == "add-label" && a.LabelId == nil:
+			return false, "add-label needs a label-id"
+		case a.Type == "comment" && strings.TrimSpace(a.Body) == "":
+			return false, "comment needs a body"
+		case a.Type == "comment" && len(a.Body) > maxCommentLength:
+			return false, "Comment body is longer than " + strconv.Itoa(maxCommentLength) + " characters"
+		case a.Type == "fire-webhook" && a.WebhookId == nil:
+			return false, "fire-webhook needs a webhook-id"
+		}
+	}
+
+	return true, ""
+}
+
+// checkRule validates a rule and checks the labels and webhooks it refers
+// to belong to its project and its users exist.
+func checkRule(r *Rule) (bool, string, error) {
+	ok, message := validRule(r)
+	if !ok {
+		return false, message, nil
+	}
+
+	labelIds := []*int64{r.Trigger.LabelId}
+	userIds := []*int64{r.Trigger.UserId}
+	webhookIds := make([]*int64, 0)
+
+	for _, c := range r.Conditions {
+		if c.Field == "label" {
+			labelIds = append(labelIds, c.Id)
+		} else if c.Field == "assignee" {
+			userIds = append(userIds, c.Id)
+		}
+	}
+
+	for _, a := range r.Actions {
+		labelIds = append(labelIds, a.LabelId)
+		userIds = append(userIds, a.UserId)
+		webhookIds = append(webhookIds, a.WebhookId)
+	}
+
+	for _, id := range labelIds {
+		if id == nil {
+			continue
+		}
+
+		var projectId int64
+		err := labelProjectQuery.QueryRow(*id).Scan(&projectId)
+		if err == sql.ErrNoRows || (err == nil && projectId != r.ProjectId) {
+			return false, "Label " + strconv.FormatInt(*id, 10) + " does not belong to the project", nil
+		}
+
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	for _, id := range userIds {
+		if id == nil {
+			continue
+		}
+
+		var exists bool
+		err := checkUserExistsQuery.QueryRow(*id).Scan(&exists)
+		if err != nil {
+			return false, "", err
+		}
+
+		if !exists {
+			return false, "User " + strconv.FormatInt(*id, 10) + " does not exist", nil
+		}
+	}
+
+	for _, id := range webhookIds {
+		if id == nil {
+			continue
+		}
+
+		wh, err := getWebhook(*id)
+		if err == sql.ErrNoRows || (err == nil && wh.ProjectId != r.ProjectId) {
+			return false, "Webhook " + strconv.FormatInt(*id, 10) + " does not belong to the project", nil
+		}
+
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	return true, "", nil
+}
+
+func scanRule(row rowScanner) (Rule, error) {
+	r := Rule{}
+	var trigger, conditions, actions []byte
+	var active bool
+
+	err := row.Scan(&r.Id, &r.ProjectId, &r.Name, &trigger, &conditions, &actions, &active, &r.CreatedBy)
+	if err != nil {
+		return r, err
+	}
+
+	r.Active = &active
+
+	err = json.Unmarshal(trigger, &r.Trigger)
+	if err != nil {
+		return r, err
+	}
+
+	err = json.Unmarshal(conditions, &r.Conditions)
+	if err != nil {
+		return r, err
+	}
+
+	err = json.Unmarshal(actions, &r.Actions)
+	return r, err
+}
+
+var getRuleQuery *sql.Stmt = prepareQuery("sql/get_rule.sql")
+
+func getRule(id int64) (*Rule, error) {
+	r, err := scanRule(getRuleQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ruleArgs are the trigger, conditions and actions of a rule as stored.
+func ruleArgs(r *Rule) (string, string, string) {
+	if r.Conditions == nil {
+		r.Conditions = make([]RuleCondition, 0)
+	}
+
+	trigger, _ := json.Marshal(r.Trigger)
+	conditions, _ := json.Marshal(r.Conditions)
+	actions, _ := json.Marshal(r.Actions)
+
+	return string(trigger), string(conditions), string(actions)
+}
+
+func scanRuleRun(row rowScanner) (RuleRun, error) {
+	run := RuleRun{}
+	var changes []byte
+	var message sql.NullString
+	var dueAt sql.NullTime
+
+	err := row.Scan(&run.Id, &run.RuleId, &run.TaskId, &run.Event, &run.Status, &changes, &message, &dueAt, &run.CreatedAt)
+	if err != nil {
+		return run, err
+	}
+
+	run.Changes = json.RawMessage(changes)
+	run.Error = message.String
+
+	if dueAt.Valid {
+		t := dueAt.Time
+		run.DueAt = &t
+	}
+
+	return run, nil
+}
+
+var triggeredRulesQuery *sql.Stmt = prepareQuery("sql/get_triggered_rules.sql")
+
+var newRuleRunQuery *sql.Stmt = prepareQuery("sql/new_rule_run.sql")
+
+var ruleTaskQuery string = loadQuery("sql/get_rule_task.sql")
+
+var claimRuleRunQuery string = loadQuery("sql/new_rule_run.sql")
+
+var finishRuleRunQuery string = loadQuery("sql/finish_rule_run.sql")
+
+var ruleStatusQuery string = loadQuery("sql/update_task_status.sql")
+
+var ruleAssignQuery string = loadQuery("sql/new_task_assignee.sql")
+
+var ruleUnassignQuery string = loadQuery("sql/delete_rule_task_assignees.sql")
+
+var ruleLabelQuery string = loadQuery("sql/new_task_label.sql")
+
+var ruleCommentQuery string = loadQuery("sql/new_comment.sql")
+
+var ruleWebhookQuery string = loadQuery("sql/new_rule_webhook_delivery.sql")
+
+// ruleRun carries out the actions of one rule on one task inside a
+// transaction. Notifications and events are kept in after until it is
+// committed.
+type ruleRun struct {
+	tx *sql.Tx
+	rule *Rule
+	taskId int64
+	trigger string
+	task *ruleTask
+	chain []int64
+	changes []Change
+	after []func()
+}
+
+// publish queues an event for after the commit, carrying the rule chain so
+// the rules it triggers know how they were reached.
+func (r *ruleRun) publish(eventType string, data interface{}) {
+	taskId := r.taskId
+	e := &Event{Type: eventType, ProjectId: r.rule.ProjectId, TaskId: &taskId, ActorId: r.rule.CreatedBy, Data: data, Rules: r.chain}
+
+	r.after = append(r.after, func() {
+		publish(e)
+	})
+}
+
+func (r *ruleRun) do(a *RuleAction) (error) {
+	actorId := r.rule.CreatedBy
+
+	switch a.Type {
+	case "set-status":
+		if r.task.Status == a.Status {
+			return nil
+		}
+
+		ok, message, err := statusChangeAllowed(r.tx, r.taskId, a.Status)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return errors.New(message)
+		}
+
+		var oldStatus json.RawMessage
+		err = r.tx.QueryRow(ruleStatusQuery, r.taskId, a.Status, actorId).Scan(&oldStatus)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		r.task.Status = a.Status
+		status := a.Status
+
+		r.changes = append(r.changes, Change{"status", status})
+		r.after = append(r.after, func() {
+			notifyWatchers("status", r.taskId, nil, actorId, map[string]interface{}{"old": oldStatus, "new": status}, nil)
+		})
+		r.publish("task.updated", &Change{"status", status})
+
+	case "assign":
+		userId := *a.UserId
+		if containsId(r.task.Assignees, userId) {
+			return nil
+		}
+
+		_, err := r.tx.Exec(ruleAssignQuery, userId, r.taskId, actorId)
+		if err != nil {
+			return err
+		}
+
+		r.task.Assignees = append(r.task.Assignees, userId)
+
+		r.changes = append(r.changes, Change{"assignee", userId})
+		r.after = append(r.after, func() {
+			notifyUsers("assignment", r.taskId, nil, actorId, nil, []int64{userId})
+		})
+		r.publish("task.assigned", &TaskAssignee{TaskId: r.taskId, UserId: userId})
+
+	case "unassign":
+		rows, err := r.tx.Query(ruleUnassignQuery, r.taskId, a.UserId, actorId)
+		if err != nil {
+			return err
+		}
+
+		removed := make([]int64, 0)
+
+		for rows.Next() {
+			var userId int64
+			err := rows.Scan(&userId)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			removed = append(removed, userId)
+		}
+
+		rows.Close()
+
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range removed {
+			r.task.Assignees = removeId(r.task.Assignees, userId)
+			r.changes = append(r.changes, Change{"assignee-removed", userId})
+			r.publish("task.updated", &Change{"assignee-removed", userId})
+		}
+
+	case "add-label":
+		labelId := *a.LabelId
+
+		res, err := r.tx.Exec(ruleLabelQuery, r.taskId, labelId, actorId)
+		if err != nil {
+			return err
+		}
+
+		added, _ := res.RowsAffected()
+		if added == 0 {
+			return nil
+		}
+
+		r.task.Labels = append(r.task.Labels, labelId)
+
+		r.changes = append(r.changes, Change{"label-added", labelId})
+		r.publish("task.updated", &Change{"label-added", labelId})
+
+	case "comment":
+		var commentId int64
+		var createdAt time.Time
+
+		err := r.tx.QueryRow(ruleCommentQuery, r.taskId, nil, actorId, a.Body).Scan(&commentId, &createdAt)
+		if err != nil {
+			return err
+		}
+
+		mentioned, err := recordMentions(r.tx, r.taskId, &commentId, a.Body, actorId)
+		if err != nil {
+			return err
+		}
+
+		r.changes = append(r.changes, Change{"comment", commentId})
+		r.after = append(r.after, func() {
+			notifyUsers("mention", r.taskId, &commentId, actorId, nil, mentioned)
+			notifyWatchers("comment", r.taskId, &commentId, actorId, nil, mentioned)
+		})
+
+	case "fire-webhook":
+		taskId := r.taskId
+		payload, _ := json.Marshal(&Event{
+			Type: "rule.fired",
+			ProjectId: r.rule.ProjectId,
+			TaskId: &taskId,
+			ActorId: actorId,
+			Data: map[string]interface{}{"rule-id": r.rule.Id, "rule-name": r.rule.Name, "trigger": r.trigger},
+			At: time.Now(),
+		})
+
+		_, err := r.tx.Exec(ruleWebhookQuery, *a.WebhookId, "rule.fired", string(payload))
+		if err != nil {
+			return err
+		}
+
+		r.changes = append(r.changes, Change{"webhook", *a.WebhookId})
+	}
+
+	return nil
+}
+
+// executeRule checks a rule's conditions against a task and runs its actions,
+// logging the run in the same transaction. Runs of due-date-passed rules
+// carry the due date, which the log holds once per rule and task, so a
+// missed due date fires a rule once however many servers check it. It
+// returns what to do after the commit.
+func executeRule(rule *Rule, taskId int64, trigger string, chain []int64, dueAt *time.Time) ([]func(), error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	t := &ruleTask{}
+	var labels, assignees []byte
+
+	err = tx.QueryRow(ruleTaskQuery, taskId).Scan(&t.Status, &t.Priority, &t.Closed, &labels, &assignees)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(labels, &t.Labels)
+	json.Unmarshal(assignees, &t.Assignees)
+
+	status := "success"
+	var message *string
+
+	if t.Closed || !rule.holds(t) {
+		// A passed due date is looked up again on every run until a run is
+		// recorded for it, so it is recorded as skipped rather than dropped.
+		if dueAt == nil {
+			return nil, nil
+		}
+
+		status = "skipped"
+		m := "The task did not match the rule's conditions"
+		if t.Closed {
+			m = "The task was closed"
+		}
+		message = &m
+	} else if containsId(chain, rule.Id) {
+		status = "skipped"
+		m := "The rule already ran earlier in this chain of rules"
+		message = &m
+	} else if len(chain) >= maxRuleChain {
+		status = "skipped"
+		m := "More than " + strconv.Itoa(maxRuleChain) + " rules ran in a row"
+		message = &m
+	}
+
+	var runId int64
+	err = tx.QueryRow(claimRuleRunQuery, rule.Id, taskId, trigger, status, message, dueAt).Scan(&runId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if status == "skipped" {
+		return nil, tx.Commit()
+	}
+
+	run := &ruleRun{
+		tx: tx,
+		rule: rule,
+		taskId: taskId,
+		trigger: trigger,
+		task: t,
+		chain: append(append([]int64{}, chain...), rule.Id),
+		changes: make([]Change, 0),
+	}
+
+	for i := range rule.Actions {
+		err := run.do(&rule.Actions[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changes, _ := json.Marshal(run.changes)
+
+	_, err = tx.Exec(finishRuleRunQuery, runId, string(changes))
+	if err != nil {
+		return nil, err
+	}
+
+	return run.after, tx.Commit()
+}
+
+// runRule runs a rule on a task. A failed run is rolled back and logged.
+func runRule(rule *Rule, taskId int64, trigger string, chain []int64, dueAt *time.Time) {
+	after, err := executeRule(rule, taskId, trigger, chain, dueAt)
+	if err != nil {
+		log.Println("Rule " + strconv.FormatInt(rule.Id, 10) + " failed on task " + strconv.FormatInt(taskId, 10) + ": " + err.Error())
+
+		message := err.Error()
+		_, err := newRuleRunQuery.Exec(rule.Id, taskId, trigger, "failed", &message, dueAt)
+		if err != nil {
+			log.Println("Failed to log rule run: " + err.Error())
+		}
+		return
+	}
+
+	for _, f := range after {
+		f()
+	}
+}
+
+// runRules runs the rules of the event's project that it triggers.
+func runRules(e *Event) {
+	trigger, value := ruleTrigger(e)
+	if trigger == "" {
+		return
+	}
+
+	rows, err := triggeredRulesQuery.Query(e.ProjectId, trigger)
+	if err != nil {
+		log.Println("Failed to load rules: " + err.Error())
+		return
+	}
+
+	rules := make(Rules, 0)
+
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			log.Println("Failed to load rules: " + err.Error())
+			rows.Close()
+			return
+		}
+
+		if r.Trigger.matches(value) {
+			rules = append(rules, r)
+		}
+	}
+
+	rows.Close()
+
+	for i := range rules {
+		runRule(&rules[i], *e.TaskId, trigger, e.Rules, nil)
+	}
+}
+
+var overdueRuleTasksQuery *sql.Stmt = prepareQuery("sql/get_overdue_rule_tasks.sql")
+
+// overdueBatch is how many missed due dates one check handles.
+const overdueBatch = 100
+
+// runDueRules runs the due-date-passed rules of tasks whose due date has
+// passed since the last check.
+func runDueRules(now time.Time) {
+	rows, err := overdueRuleTasksQuery.Query(now, overdueBatch)
+	if err != nil {
+		log.Println("Failed to load overdue tasks: " + err.Error())
+		return
+	}
+
+	type overdue struct {
+		ruleId int64
+		taskId int64
+		dueAt time.Time
+	}
+
+	due := make([]overdue, 0)
+
+	for rows.Next() {
+		var o overdue
+		err := rows.Scan(&o.ruleId, &o.taskId, &o.dueAt)
+		if err != nil {
+			log.Println("Failed to load overdue tasks: " + err.Error())
+			rows.Close()
+			return
+		}
+		due = append(due, o)
+	}
+
+	rows.Close()
+
+	rules := make(map[int64]*Rule)
+
+	for _, o := range due {
+		rule, ok := rules[o.ruleId]
+		if !ok {
+			rule, err = getRule(o.ruleId)
+			if err != nil {
+				log.Println("Failed to load rule " + strconv.FormatInt(o.ruleId, 10) + ": " + err.Error())
+				continue
+			}
+			rules[o.ruleId] = rule
+		}
+
+		dueAt := o.dueAt
+		runRule(rule, o.taskId, "due-date-passed", nil, &dueAt)
+	}
+}
+
+// automationRunner runs rules on published task events, off the request
+// goroutine, and schedules checking for passed due dates.
+func automationRunner() {
+	listen(func(e *Event) {
+		if trigger, _ := ruleTrigger(e); trigger != "" {
+			go runRules(e)
+		}
+	})
+
+	err := scheduler.AddFunc(config.Automation.Schedule, func() {
+		runDueRules(time.Now())
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+func newRuleHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_rule.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var rule Rule
+
+		err := json.NewDecoder(r.Body).Decode(&rule)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "rule",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &rule.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message, err = checkRule(&rule)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if rule.Active == nil {
+			active := true
+			rule.Active = &active
+		}
+
+		trigger, conditions, actions := ruleArgs(&rule)
+
+		err = stmt.QueryRow(rule.ProjectId, rule.Name, rule.Trigger.Type, trigger, conditions, actions, *rule.Active, auId).Scan(&rule.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rule.CreatedBy = auId
+
+		json.NewEncoder(w).Encode(&rule)
+	}
+}
+
+// updateRuleHandler replaces a rule's name, trigger, conditions, actions and
+// active flag. It keeps running as the user who made it.
+func updateRuleHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_rule.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var rule Rule
+
+		err := json.NewDecoder(r.Body).Decode(&rule)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getRule(rule.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rule does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "rule",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		rule.ProjectId = current.ProjectId
+		rule.CreatedBy = current.CreatedBy
+
+		ok, message, err = checkRule(&rule)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if rule.Active == nil {
+			rule.Active = current.Active
+		}
+
+		trigger, conditions, actions := ruleArgs(&rule)
+
+		_, dberr := stmt.Exec(rule.Id, rule.Name, rule.Trigger.Type, trigger, conditions, actions, *rule.Active)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&rule)
+	}
+}
+
+func deleteRuleHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_rule.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		rule, err := getRule(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rule does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "rule",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &rule.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(id)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getProjectRulesHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_rules.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		projectId, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "rule",
+			Action: "select",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		rows, err := db.Query(query, projectId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		rules := make(Rules, 0)
+
+		for rows.Next() {
+			rule, err := scanRule(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			rules = append(rules, rule)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&rules)
+	}
+}
+
+// getRuleRunsHandler pages through the execution log of a rule, newest
+// first.
+func getRuleRunsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_rule_runs.sql")
+	countQuery := loadQuery("sql/count_rule_runs.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["ruleid"] == nil {
+			http.Error(w, "ruleid param is unavailable", 400)
+			return
+		}
+
+		ruleId, err := strconv.ParseInt(q["ruleid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		limit, offset, err := pagination(q)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rule, err := getRule(ruleId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rule does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "rule",
+			Action: "select",
+			ActiveUserId: auId,
+			ProjectId: &rule.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		page := &RuleRunPage{Limit: limit, Offset: offset}
+
+		err = db.QueryRow(countQuery, ruleId).Scan(&page.Total)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(query, ruleId, limit, offset)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		page.Runs = make(RuleRuns, 0)
+
+		for rows.Next() {
+			run, err := scanRuleRun(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			page.Runs = append(page.Runs, run)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(page)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRuleTrigger(t *testing.T) {
+	taskId := int64(4)
+	bug := int64(9)
+
+	tests := []struct {
+		event Event
+		trigger RuleTrigger
+		fires bool
+	}{
+		{Event{Type: "task.updated", Data: &Change{"status", "Done"}}, RuleTrigger{Type: "status-changed", Status: "Done"}, true},
+		{Event{Type: "task.updated", Data: &Change{"status", "OnGoing"}}, RuleTrigger{Type: "status-changed", Status: "Done"}, false},
+		{Event{Type: "task.updated", Data: &Change{"status", "OnGoing"}}, RuleTrigger{Type: "status-changed"}, true},
+		{Event{Type: "task.updated", Data: &Change{"label-added", bug}}, RuleTrigger{Type: "label-added", LabelId: &bug}, true},
+		{Event{Type: "task.updated", Data: &Change{"label-added", int64(3)}}, RuleTrigger{Type: "label-added", LabelId: &bug}, false},
+		{Event{Type: "task.updated", Data: &Change{"label-removed", bug}}, RuleTrigger{Type: "label-added"}, false},
+		{Event{Type: "task.assigned", Data: &TaskAssignee{TaskId: 4, UserId: 2}}, RuleTrigger{Type: "assigned"}, true},
+		{Event{Type: "task.updated", Data: &Change{"name", "Done"}}, RuleTrigger{Type: "status-changed"}, false},
+	}
+
+	for i, test := range tests {
+		test.event.TaskId = &taskId
+
+		trigger, value := ruleTrigger(&test.event)
+		fires := trigger == test.trigger.Type && test.trigger.matches(value)
+		if fires != test.fires {
+			t.Errorf("case %d: fires = %v, want %v", i, fires, test.fires)
+		}
+	}
+}
+
+func TestRuleConditions(t *testing.T) {
+	triager := int64(2)
+	bug := int64(9)
+
+	task := &ruleTask{Status: "Todo", Priority: "high", Labels: []int64{bug}, Assignees: []int64{}}
+
+	tests := []struct {
+		condition RuleCondition
+		holds bool
+	}{
+		{RuleCondition{Field: "status", Op: "is", Value: "Todo"}, true},
+		{RuleCondition{Field: "status", Op: "is-not", Value: "Todo"}, false},
+		{RuleCondition{Field: "priority", Op: "is", Value: "low"}, false},
+		{RuleCondition{Field: "label", Op: "has", Id: &bug}, true},
+		{RuleCondition{Field: "label", Op: "has-not"}, false},
+		{RuleCondition{Field: "assignee", Op: "has-not"}, true},
+		{RuleCondition{Field: "assignee", Op: "has", Id: &triager}, false},
+	}
+
+	for i, test := range tests {
+		if holds := test.condition.holds(task); holds != test.holds {
+			t.Errorf("case %d: holds = %v, want %v", i, holds, test.holds)
+		}
+	}
+}
+
+func TestValidRule(t *testing.T) {
+	triager := int64(2)
+
+	rule := &Rule{
+		Name: "Triage bugs",
+		Trigger: RuleTrigger{Type: "label-added"},
+		Conditions: []RuleCondition{{Field: "assignee", Op: "has-not"}},
+		Actions: []RuleAction{{Type: "assign", UserId: &triager}, {Type: "unassign"}},
+	}
+
+	if ok, message := validRule(rule); !ok {
+		t.Fatalf("valid rule rejected: %s", message)
+	}
+
+	invalid := []func(r *Rule){
+		func(r *Rule) { r.Name = " " },
+		func(r *Rule) { r.Trigger.Type = "task.created" },
+		func(r *Rule) { r.Conditions[0].Op = "is" },
+		func(r *Rule) { r.Actions = nil },
+		func(r *Rule) { r.Actions[0].UserId = nil },
+		func(r *Rule) { r.Actions[0] = RuleAction{Type: "set-status", Status: "Closed"} },
+	}
+
+	for i, change := range invalid {
+		r := *rule
+		r.Conditions = append([]RuleCondition{}, rule.Conditions...)
+		r.Actions = append([]RuleAction{}, rule.Actions...)
+		change(&r)
+
+		if ok, _ := validRule(&r); ok {
+			t.Errorf("case %d: invalid rule accepted", i)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+func checkBlobStore(t *testing.T, store BlobStore) {
+	err := store.Put("tasks/1/abc", strings.NewReader("hello"), 5, "text/plain")
+	if err != nil {
+		t.Fatal("Put failed with", err.Error())
+	}
+
+	blob, err := store.Get("tasks/1/abc")
+	if err != nil {
+		t.Fatal("Get failed with", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(blob)
+	blob.Close()
+
+	if string(body) != "hello" {
+		t.Fatal("Blob contents should be hello, are", string(body))
+	}
+
+	err = store.Delete("tasks/1/abc")
+	if err != nil {
+		t.Fatal("Delete failed with", err.Error())
+	}
+
+	_, err = store.Get("tasks/1/abc")
+	if err != ErrBlobNotFound {
+		t.Fatal("Deleted blob should not be found, got", err)
+	}
+
+	err = store.Put("../escape", strings.NewReader("x"), 1, "text/plain")
+	if err == nil {
+		t.Fatal("Keys with .. segments should be rejected")
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kanelm-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkBlobStore(t, &LocalBlobStore{Dir: dir})
+}
+
+// fakeS3 is a minimal stand-in for MinIO that keeps objects in memory.
+type fakeS3 struct {
+	mu sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		http.Error(w, "AccessDenied", 403)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	case "GET":
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", 404)
+			return
+		}
+		w.Write(body)
+	case "DELETE":
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(204)
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	defer server.Close()
+
+	checkBlobStore(t, &S3BlobStore{
+		Endpoint: server.URL,
+		Region: "us-east-1",
+		Bucket: "kanelm",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+	})
+}
+
+func TestAllowedContentType(t *testing.T) {
+	allowed := []string{"image/*", "text/plain"}
+
+	if !allowedContentType("image/png", allowed) {
+		t.Fatal("image/png should match image/*")
+	}
+
+	if !allowedContentType("text/plain; charset=utf-8", allowed) {
+		t.Fatal("text/plain with a charset should be allowed")
+	}
+
+	if allowedContentType("application/x-msdownload", allowed) {
+		t.Fatal("application/x-msdownload should not be allowed")
+	}
+}
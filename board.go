@@ -0,0 +1,363 @@
+package main
+
+import (
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// boardColumns are the task statuses shown as columns, in board order.
+var boardColumns = []string{"Todo", "OnGoing", "Done"}
+
+// priorities lists task priorities from most to least urgent.
+var priorities = []string{"urgent", "high", "medium", "low", "none"}
+
+// BoardQuery asks for the tasks matching a TaskQuery grouped into swimlanes
+// by assignee, priority, label or epic.
+type BoardQuery struct {
+	TaskQuery
+	GroupBy string `json:"group-by"`
+}
+
+type BoardCell struct {
+	Column string `json:"column"`
+	Count int `json:"count"`
+	Tasks Tasks `json:"tasks"`
+}
+
+// Swimlane is one row of the board. Key is the id of the assignee, label or
+// epic, or the priority name, and is empty for the lane of tasks without one.
+type Swimlane struct {
+	Key string `json:"key"`
+	Name string `json:"name"`
+	Count int `json:"count"`
+	Cells []BoardCell `json:"cells"`
+}
+
+type Board struct {
+	ProjectId int64 `json:"project-id"`
+	GroupBy string `json:"group-by"`
+	Columns []string `json:"columns"`
+	Lanes []Swimlane `json:"lanes"`
+}
+
+// lane names a swimlane before tasks are placed in it.
+type lane struct {
+	Key string
+	Name string
+}
+
+var projectTaskAssigneesQuery *sql.Stmt = prepareQuery("sql/get_project_task_assignees.sql")
+
+// projectTaskAssignees returns the users assigned to every task in a project keyed by task id.
+func projectTaskAssignees(projectId int64) (map[int64]Users, error) {
+	rows, err := projectTaskAssigneesQuery.Query(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	assignees := make(map[int64]Users)
+
+	for rows.Next() {
+		var taskId int64
+		u := User{}
+
+		err := rows.Scan(&taskId, &u.Id, &u.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		assignees[taskId] = append(assignees[taskId], u)
+	}
+
+	return assignees, rows.Err()
+}
+
+var projectLabelsQuery *sql.Stmt = prepareQuery("sql/get_project_labels.sql")
+
+var projectMilestonesQuery *sql.Stmt = prepareQuery("sql/get_project_milestones.sql")
+
+// taskColumns returns the board columns followed by any other status the
+// tasks are in.
+func taskColumns(tasks Tasks) ([]string) {
+	columns := append([]string{}, boardColumns...)
+	for _, task := range tasks {
+		known := false
+		for _, c := range columns {
+			if c == task.Status {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			columns = append(columns, task.Status)
+		}
+	}
+
+	return columns
+}
+
+// buildBoard places tasks in the cells of the given lanes. lanesOf returns
+// the lane keys of a task, so a task with two assignees shows in both lanes
+// and a task with none goes to the lane with an empty key. Lanes left empty
+// are dropped, as are tasks in lanes or columns that were not listed.
+func buildBoard(projectId int64, groupBy string, columns []string, tasks Tasks, lanes []lane, lanesOf func(*Task) []string) (*Board) {
+	cells := make(map[string]map[string]Tasks)
+
+	for i := range tasks {
+		for _, key := range lanesOf(&tasks[i]) {
+			if cells[key] == nil {
+				cells[key] = make(map[string]Tasks)
+			}
+			cells[key][tasks[i].Status] = append(cells[key][tasks[i].Status], tasks[i])
+		}
+	}
+
+	board := &Board{ProjectId: projectId, GroupBy: groupBy, Columns: columns, Lanes: make([]Swimlane, 0)}
+
+	for _, l := range lanes {
+		laneCells, ok := cells[l.Key]
+		if !ok {
+			continue
+		}
+
+		s := Swimlane{Key: l.Key, Name: l.Name, Cells: make([]BoardCell, 0, len(columns))}
+
+		for _, c := range columns {
+			cellTasks := laneCells[c]
+			if cellTasks == nil {
+				cellTasks = make(Tasks, 0)
+			}
+
+			s.Cells = append(s.Cells, BoardCell{Column: c, Count: len(cellTasks), Tasks: cellTasks})
+			s.Count += len(cellTasks)
+		}
+
+		board.Lanes = append(board.Lanes, s)
+	}
+
+	return board
+}
+
+func assigneeLanes(projectId int64) ([]lane, error) {
+	assignees, err := projectTaskAssignees(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(set)
+	users := make(Users, 0)
+
+	for _, taskUsers := range assignees {
+		for _, u := range taskUsers {
+			key := strconv.FormatInt(u.Id, 10)
+			if !seen.Has(key) {
+				seen.Add(key)
+				users = append(users, u)
+			}
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+
+	lanes := make([]lane, 0, len(users) + 1)
+	for _, u := range users {
+		lanes = append(lanes, lane{Key: strconv.FormatInt(u.Id, 10), Name: u.Name})
+	}
+
+	return append(lanes, lane{Key: "", Name: "Unassigned"}), nil
+}
+
+func priorityLanes() ([]lane) {
+	lanes := make([]lane, 0, len(priorities))
+	for _, p := range priorities {
+		if p == "none" {
+			lanes = append(lanes, lane{Key: "", Name: "No priority"})
+			continue
+		}
+		lanes = append(lanes, lane{Key: p, Name: p})
+	}
+	return lanes
+}
+
+func labelLanes(projectId int64) ([]lane, error) {
+	rows, err := projectLabelsQuery.Query(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	lanes := make([]lane, 0)
+
+	for rows.Next() {
+		l := Label{}
+
+		err := rows.Scan(&l.Id, &l.ProjectId, &l.Name, &l.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		lanes = append(lanes, lane{Key: strconv.FormatInt(l.Id, 10), Name: l.Name})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(lanes, lane{Key: "", Name: "No label"}), nil
+}
+
+func epicLanes(projectId int64) ([]lane, error) {
+	rows, err := projectMilestonesQuery.Query(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	lanes := make([]lane, 0)
+
+	for rows.Next() {
+		var id int64
+		var name string
+		var target time.Time
+
+		err := rows.Scan(&id, &name, &target)
+		if err != nil {
+			return nil, err
+		}
+
+		lanes = append(lanes, lane{Key: strconv.FormatInt(id, 10), Name: name})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(lanes, lane{Key: "", Name: "No epic"}), nil
+}
+
+func lanesOfTask(groupBy string) (func(*Task) []string) {
+	return func(t *Task) []string {
+		keys := make([]string, 0)
+
+		switch groupBy {
+		case "assignee":
+			for _, id := range t.Assignees {
+				keys = append(keys, strconv.FormatInt(id, 10))
+			}
+		case "priority":
+			if t.Priority != "none" {
+				keys = append(keys, t.Priority)
+			}
+		case "label":
+			for _, l := range t.Labels {
+				keys = append(keys, strconv.FormatInt(l.Id, 10))
+			}
+		case "epic":
+			if t.MilestoneId != nil {
+				keys = append(keys, strconv.FormatInt(*t.MilestoneId, 10))
+			}
+		}
+
+		if len(keys) == 0 {
+			keys = append(keys, "")
+		}
+
+		return keys
+	}
+}
+
+// boardLanes lists the swimlanes of a project for a group-by, or a single
+// lane holding every task when groupBy is empty.
+func boardLanes(projectId int64, groupBy string) ([]lane, error) {
+	switch groupBy {
+	case "":
+		return []lane{lane{Key: "", Name: "All tasks"}}, nil
+	case "assignee":
+		return assigneeLanes(projectId)
+	case "priority":
+		return priorityLanes(), nil
+	case "label":
+		return labelLanes(projectId)
+	case "epic":
+		return epicLanes(projectId)
+	}
+
+	return nil, &queryError{"group-by must be one of assignee, priority, label or epic"}
+}
+
+func getProjectBoardHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a body with your request", 400)
+			return
+		}
+
+		var bq BoardQuery
+		err := json.NewDecoder(r.Body).Decode(&bq)
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if bq.Id == 0 {
+			http.Error(w, "Please include a id field with request body", 400)
+			return
+		}
+
+		if bq.GroupBy == "" {
+			http.Error(w, "group-by must be one of assignee, priority, label or epic", 400)
+			return
+		}
+
+		// Archived tasks stay off boards, they are only found by querying tasks.
+		bq.Archived = false
+
+		lanes, err := boardLanes(bq.Id, bq.GroupBy)
+
+		if _, ok := err.(*queryError); ok {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		tasks, err := queryProjectTasks(&bq.TaskQuery)
+
+		if _, ok := err.(*queryError); ok {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(buildBoard(bq.Id, bq.GroupBy, taskColumns(tasks), tasks, lanes, lanesOfTask(bq.GroupBy)))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBuildBoard(t *testing.T) {
+	tasks := Tasks{
+		Task{Id: 1, Status: "Todo", Assignees: []int64{1, 2}},
+		Task{Id: 2, Status: "Done", Assignees: []int64{2}},
+		Task{Id: 3, Status: "OnGoing", Assignees: []int64{}},
+	}
+
+	lanes := []lane{lane{Key: "1", Name: "ricky"}, lane{Key: "2", Name: "shiba"}, lane{Key: "3", Name: "idle"}, lane{Key: "", Name: "Unassigned"}}
+
+	board := buildBoard(7, "assignee", taskColumns(tasks), tasks, lanes, lanesOfTask("assignee"))
+
+	if len(board.Columns) != 3 {
+		t.Fatal("Board should have the Todo, OnGoing and Done columns, has", board.Columns)
+	}
+
+	if len(board.Lanes) != 3 {
+		t.Fatal("Lanes without tasks should be dropped, got", len(board.Lanes))
+	}
+
+	shiba := board.Lanes[1]
+	if shiba.Name != "shiba" || shiba.Count != 2 {
+		t.Fatal("shiba should have two tasks, has", shiba.Count)
+	}
+
+	if shiba.Cells[0].Column != "Todo" || shiba.Cells[0].Count != 1 || shiba.Cells[2].Count != 1 {
+		t.Fatal("shiba should have one Todo and one Done task")
+	}
+
+	unassigned := board.Lanes[2]
+	if unassigned.Key != "" || unassigned.Cells[1].Count != 1 || unassigned.Cells[1].Tasks[0].Id != 3 {
+		t.Fatal("Task 3 should be in the OnGoing cell of the unassigned lane")
+	}
+}
+
+func TestBuildBoardUnknownStatus(t *testing.T) {
+	tasks := Tasks{Task{Id: 1, Status: "Review", Priority: "high"}}
+
+	board := buildBoard(7, "priority", taskColumns(tasks), tasks, priorityLanes(), lanesOfTask("priority"))
+
+	if len(board.Columns) != 4 || board.Columns[3] != "Review" {
+		t.Fatal("Unknown statuses should be added as columns after the board columns, got", board.Columns)
+	}
+
+	if len(board.Lanes) != 1 || board.Lanes[0].Key != "high" || board.Lanes[0].Cells[3].Count != 1 {
+		t.Fatal("The task should be in the Review cell of the high lane")
+	}
+}
+
+func TestSavedBoardFilter(t *testing.T) {
+	tasks := Tasks{
+		Task{Id: 1, Status: "Todo", Labels: Labels{Label{Id: 4}}, Assignees: []int64{1}},
+		Task{Id: 2, Status: "Todo", Labels: Labels{Label{Id: 5}}, Assignees: []int64{2}},
+		Task{Id: 3, Status: "Done", Labels: Labels{Label{Id: 4}}, Assignees: []int64{2}},
+		Task{Id: 4, Status: "Review", Labels: Labels{Label{Id: 4}}, Assignees: []int64{}},
+	}
+
+	f := BoardFilter{LabelIds: []int64{4}, Mine: true}
+	tq := f.taskQuery(7, 2)
+
+	if tq.Id != 7 || len(tq.AssigneeIds) != 1 || tq.AssigneeIds[0] != 2 {
+		t.Fatal("Mine should filter on the viewer, got", tq.AssigneeIds)
+	}
+
+	filtered := filterTaskMembers(tasks, tq.LabelIds, tq.AssigneeIds)
+	if len(filtered) != 1 || filtered[0].Id != 3 {
+		t.Fatal("Only task 3 has label 4 and is assigned to user 2, got", filtered)
+	}
+
+	bugs := filterTaskMembers(tasks, []int64{4}, nil)
+
+	board := buildBoard(7, "", []string{"Todo", "Review"}, bugs, []lane{lane{Key: "", Name: "All tasks"}}, lanesOfTask(""))
+
+	if len(board.Lanes) != 1 || len(board.Lanes[0].Cells) != 2 {
+		t.Fatal("A board without group-by should have one lane with a cell per column")
+	}
+
+	if board.Lanes[0].Count != 2 || board.Lanes[0].Cells[1].Tasks[0].Id != 4 {
+		t.Fatal("Tasks outside the board columns should be left out, got", board.Lanes[0].Count)
+	}
+}
+
+func TestValidSavedBoard(t *testing.T) {
+	b := SavedBoard{Name: "Bugs", Columns: []string{"Todo", "Done"}}
+	if ok, message := validSavedBoard(&b); !ok {
+		t.Fatal(message)
+	}
+
+	b.Columns = []string{"Todo", "Todo"}
+	if ok, _ := validSavedBoard(&b); ok {
+		t.Fatal("Columns listed twice should be rejected")
+	}
+
+	b.Columns = []string{"Todo"}
+	b.GroupBy = "sprint"
+	if ok, _ := validSavedBoard(&b); ok {
+		t.Fatal("Unknown group-by should be rejected")
+	}
+
+	b.GroupBy = ""
+	b.Filter = BoardFilter{AssigneeIds: []int64{5}, Mine: true}
+	if ok, _ := validSavedBoard(&b); ok {
+		t.Fatal("Mine with assignee-ids should be rejected")
+	}
+}
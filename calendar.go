@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarFeed is a read-only iCalendar feed of task due dates, read with
+// its token instead of a login so calendar apps can subscribe to it. A feed
+// with a project lists that project's tasks, one without lists the tasks
+// its user is assigned to.
+type CalendarFeed struct {
+	Id int64 `json:"id"`
+	ProjectId *int64 `json:"project-id"`
+	Token string `json:"token"`
+	URL string `json:"url"`
+}
+
+type CalendarFeeds []CalendarFeed
+
+// CalendarTask is a task with a due date as a calendar event. Sequence
+// counts the task's changes, so calendars know a newer version apart.
+type CalendarTask struct {
+	Id int64
+	Name string
+	Description string
+	Status string
+	DueAt time.Time
+	UpdatedAt time.Time
+	ProjectId int64
+	ProjectName string
+	Sequence int64
+	URL string
+}
+
+func calendarFeedURL(token string) (string) {
+	return strings.TrimRight(config.Mail.BaseURL, "/") + "/calendar.ics?" + url.Values{"token": {token}}.Encode()
+}
+
+// calendarUID identifies a task's event. It depends on nothing but the task
+// id, so an event is updated in place when the task changes and removed
+// when the task drops out of the feed.
+func calendarUID(taskId int64) (string) {
+	return "task-" + strconv.FormatInt(taskId, 10) + "@kanelm"
+}
+
+var icsEscaper = strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\r\n", "\\n", "\n", "\\n", "\r", "\\n")
+
+func icsText(s string) (string) {
+	return icsEscaper.Replace(s)
+}
+
+func icsTime(t time.Time) (string) {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsLine writes a content line, folded so no line is longer than 75 bytes
+// without splitting a character.
+func icsLine(b *bytes.Buffer, line string) {
+	limit := 75
+
+	for len(line) > limit {
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+
+	b.WriteString(line + "\r\n")
+}
+
+// writeCalendar renders tasks as an iCalendar named name.
+func writeCalendar(w io.Writer, name string, tasks []CalendarTask, now time.Time) (error) {
+	var b bytes.Buffer
+
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//Kanelm//Kanelm//EN")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "METHOD:PUBLISH")
+	icsLine(&b, "X-WR-CALNAME:" + icsText(name))
+	icsLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	icsLine(&b, "X-PUBLISHED-TTL:PT1H")
+
+	for _, t := range tasks {
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, "UID:" + calendarUID(t.Id))
+		icsLine(&b, "DTSTAMP:" + icsTime(now))
+		icsLine(&b, "LAST-MODIFIED:" + icsTime(t.UpdatedAt))
+		icsLine(&b, "SEQUENCE:" + strconv.FormatInt(t.Sequence, 10))
+		icsLine(&b, "DTSTART:" + icsTime(t.DueAt))
+		icsLine(&b, "SUMMARY:" + icsText(t.Name))
+
+		if t.Description != "" {
+			icsLine(&b, "DESCRIPTION:" + icsText(t.Description))
+		}
+
+		icsLine(&b, "CATEGORIES:" + icsText(t.ProjectName) + "," + icsText(t.Status))
+
+		if t.URL != "" {
+			icsLine(&b, "URL:" + t.URL)
+		}
+
+		icsLine(&b, "END:VEVENT")
+	}
+
+	icsLine(&b, "END:VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func newCalendarFeedHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_calendar_feed.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var feed CalendarFeed
+
+		err := json.NewDecoder(r.Body).Decode(&feed)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if feed.ProjectId != nil {
+			rr := &RoleRequest{
+				Entity: "project",
+				Action: "select",
+				ActiveUserId: auId,
+				ProjectId: feed.ProjectId,
+			}
+
+			if !rr.Satisfied() {
+				http.Error(w, "User role is not satisfied for this action", 404)
+				return
+			}
+
+			var deleted bool
+			err := projectTrashStateQuery.QueryRow(*feed.ProjectId).Scan(&deleted)
+			if err == sql.ErrNoRows || (err == nil && deleted) {
+				http.Error(w, "Project does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		feed.Token, err = randomToken()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = stmt.QueryRow(auId, feed.ProjectId, feed.Token).Scan(&feed.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		feed.URL = calendarFeedURL(feed.Token)
+
+		json.NewEncoder(w).Encode(&feed)
+	}
+}
+
+// getCalendarFeedsHandler lists the active user's calendar feeds.
+func getCalendarFeedsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_calendar_feeds.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		rows, err := db.Query(query, auId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		feeds := make(CalendarFeeds, 0)
+
+		for rows.Next() {
+			var feed CalendarFeed
+			var projectId sql.NullInt64
+
+			err := rows.Scan(&feed.Id, &projectId, &feed.Token)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if projectId.Valid {
+				id := projectId.Int64
+				feed.ProjectId = &id
+			}
+
+			feed.URL = calendarFeedURL(feed.Token)
+			feeds = append(feeds, feed)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&feeds)
+	}
+}
+
+// deleteCalendarFeedHandler revokes one of the active user's feeds, for
+// when its link was shared too widely.
+func deleteCalendarFeedHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_calendar_feed.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		res, dberr := stmt.Exec(id, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		deleted, _ := res.RowsAffected()
+		if deleted == 0 {
+			http.Error(w, "Calendar feed does not exist", 404)
+			return
+		}
+	}
+}
+
+// calendarHandler serves the feed of the token in the query. It needs no
+// login, the token is the secret.
+func calendarHandler() func(http.ResponseWriter, *http.Request) {
+
+	feedQuery := loadQuery("sql/get_calendar_feed.sql")
+	projectQuery := loadQuery("sql/get_project_calendar_tasks.sql")
+	userQuery := loadQuery("sql/get_user_calendar_tasks.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "Calendar feed does not exist", 404)
+			return
+		}
+
+		var userId int64
+		var userName string
+		var projectId sql.NullInt64
+		var projectName sql.NullString
+
+		err := db.QueryRow(feedQuery, token).Scan(&userId, &userName, &projectId, &projectName)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Calendar feed does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		var rows *sql.Rows
+		name := userName + "'s tasks"
+
+		if projectId.Valid {
+			name = projectName.String
+			rows, err = db.Query(projectQuery, projectId.Int64)
+		} else {
+			rows, err = db.Query(userQuery, userId)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		tasks := make([]CalendarTask, 0)
+
+		for rows.Next() {
+			var t CalendarTask
+
+			err := rows.Scan(&t.Id, &t.Name, &t.Description, &t.Status, &t.DueAt, &t.UpdatedAt, &t.ProjectId, &t.ProjectName, &t.Sequence)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			t.URL = taskLink(t.ProjectId, t.ProjectName, userId, userName)
+			tasks = append(tasks, t)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", "inline; filename=\"kanelm.ics\"")
+		w.Header().Set("Cache-Control", "private, max-age=300")
+
+		writeCalendar(w, name, tasks, time.Now())
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCalendar(t *testing.T) {
+	due := time.Date(2026, 10, 20, 15, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)
+
+	tasks := []CalendarTask{{
+		Id: 42,
+		Name: "Ship release; tag, notes",
+		Description: "First line\nsecond line with a long tail that makes this content line longer than seventy five bytes ✓",
+		Status: "Todo",
+		DueAt: due,
+		UpdatedAt: now,
+		ProjectName: "Kanelm",
+		Sequence: 3,
+	}}
+
+	var b bytes.Buffer
+	err := writeCalendar(&b, "Kanelm", tasks, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ics := b.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:task-42@kanelm\r\n",
+		"DTSTART:20261020T150000Z\r\n",
+		"SEQUENCE:3\r\n",
+		"SUMMARY:Ship release\\; tag\\, notes\r\n",
+		"DESCRIPTION:First line\\nsecond line",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar is missing %q:\n%s", want, ics)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is longer than 75 bytes: %q", line)
+		}
+	}
+
+	unfolded := strings.Replace(ics, "\r\n ", "", -1)
+	if !strings.Contains(unfolded, "bytes ✓\r\n") {
+		t.Errorf("folding lost or split a character:\n%s", ics)
+	}
+}
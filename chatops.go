@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"database/sql"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ChatReply answers a slash command in the format Slack and Mattermost
+// expect. Tasks added and moved are shown to the channel, everything else
+// only to the user who ran the command.
+type ChatReply struct {
+	ResponseType string `json:"response_type"`
+	Text string `json:"text"`
+}
+
+// ChatLinkCode links the chat account that sends it with /kanelm link to
+// the Kanelm user it was made for, once, until it expires.
+type ChatLinkCode struct {
+	Code string `json:"code"`
+	ExpiresAt time.Time `json:"expires-at"`
+	Command string `json:"command"`
+}
+
+// chatMaxAge is how far a signed request's timestamp may be from now, so a
+// captured request can not be replayed later.
+const chatMaxAge = 5 * time.Minute
+
+const chatLinkCodeTTL = 15 * time.Minute
+
+// maxChatCommand is the largest command request read.
+const maxChatCommand = 64 << 10
+
+// chatTaskList is how many tasks /kanelm mine lists.
+const chatTaskList = 20
+
+const chatUsage = "Usage:\n" +
+	"`/kanelm add <project> <title>` adds a task, quote project names with spaces\n" +
+	"`/kanelm move <task id> <status>` moves a task to Todo, OnGoing or Done\n" +
+	"`/kanelm mine` lists your open tasks\n" +
+	"`/kanelm link <code>` links your chat account to Kanelm, get a code in Kanelm first\n" +
+	"`/kanelm unlink` unlinks it"
+
+func ephemeralReply(text string) (*ChatReply) {
+	return &ChatReply{ResponseType: "ephemeral", Text: text}
+}
+
+func channelReply(text string) (*ChatReply) {
+	return &ChatReply{ResponseType: "in_channel", Text: text}
+}
+
+// chatSignatureValid checks a request is signed the way Slack signs them:
+// v0= and the hex HMAC-SHA256 of v0:timestamp:body keyed with the signing
+// secret, with a timestamp close to now.
+func chatSignatureValid(secret string, timestamp string, body []byte, signature string, now time.Time) (bool) {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := now.Sub(time.Unix(ts, 0))
+	if age > chatMaxAge || age < -chatMaxAge {
+		return false
+	}
+
+	expected := "v0=" + hex.EncodeToString(hmacSHA256([]byte(secret), "v0:" + timestamp + ":" + string(body)))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// nextChatArg splits the first argument off a command. An argument in
+// double quotes may hold spaces.
+func nextChatArg(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ""
+	}
+
+	if s[0] == '"' {
+		end := strings.IndexByte(s[1:], '"')
+		if end >= 0 {
+			return s[1:end + 1], strings.TrimSpace(s[end + 2:])
+		}
+	}
+
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// chatStatus finds the board column a status typed in chat means.
+func chatStatus(s string) (string, bool) {
+	for _, column := range boardColumns {
+		if strings.EqualFold(column, s) {
+			return column, true
+		}
+	}
+	return "", false
+}
+
+func chatTaskRef(id int64) (string) {
+	return "#" + strconv.FormatInt(id, 10)
+}
+
+var chatLinkQuery *sql.Stmt = prepareQuery("sql/get_chat_link.sql")
+
+var useChatLinkCodeQuery *sql.Stmt = prepareQuery("sql/use_chat_link_code.sql")
+
+var deleteChatLinkQuery *sql.Stmt = prepareQuery("sql/delete_chat_link.sql")
+
+var chatProjectQuery *sql.Stmt = prepareQuery("sql/find_chat_project.sql")
+
+var chatTaskQuery *sql.Stmt = prepareQuery("sql/get_chat_task.sql")
+
+var chatUserTasksQuery *sql.Stmt = prepareQuery("sql/get_chat_user_tasks.sql")
+
+func chatLink(teamId string, chatUserId string, code string) (*ChatReply, error) {
+	if code == "" {
+		return ephemeralReply("Get a code in Kanelm, then run `/kanelm link <code>`"), nil
+	}
+
+	var userId int64
+	err := useChatLinkCodeQuery.QueryRow(code, time.Now(), teamId, chatUserId).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return ephemeralReply("That code is invalid or has expired"), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ephemeralReply("Your chat account is linked to Kanelm, try `/kanelm mine`"), nil
+}
+
+// chatAdd adds a task the way newTaskHandler does.
+func chatAdd(userId int64, args string) (*ChatReply, error) {
+	project, title := nextChatArg(args)
+	if project == "" || title == "" {
+		return ephemeralReply("Usage: `/kanelm add <project> <title>`"), nil
+	}
+
+	rows, err := chatProjectQuery.Query(project)
+	if err != nil {
+		return nil, err
+	}
+
+	var projectId int64
+	var projectName string
+	found := 0
+
+	for rows.Next() {
+		err := rows.Scan(&projectId, &projectName)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found++
+	}
+
+	rows.Close()
+
+	if found == 0 {
+		return ephemeralReply("There is no project " + project), nil
+	}
+
+	if found > 1 {
+		return ephemeralReply("More than one project is called " + project + ", use its id"), nil
+	}
+
+	rr := &RoleRequest{
+		Entity: "task",
+		Action: "insert",
+		ActiveUserId: userId,
+		ProjectId: &projectId,
+	}
+
+	if !rr.Satisfied() {
+		return ephemeralReply("You can not add tasks to " + projectName), nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	task, mentioned, err := insertTask(tx, &NewTask{Name: title, CreatedBy: userId, ProjectId: projectId}, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	taskCreated(task, mentioned, userId)
+
+	return channelReply("Added " + chatTaskRef(task.Id) + " *" + task.Name + "* to " + projectName), nil
+}
+
+// chatMove moves a task the way updateTaskStatusHandler does.
+func chatMove(userId int64, args string) (*ChatReply, error) {
+	ref, statusArg := nextChatArg(args)
+
+	taskId, err := strconv.ParseInt(strings.TrimPrefix(ref, "#"), 10, 64)
+	if err != nil || statusArg == "" {
+		return ephemeralReply("Usage: `/kanelm move <task id> <status>`"), nil
+	}
+
+	status, ok := chatStatus(statusArg)
+	if !ok {
+		return ephemeralReply("Unknown status " + statusArg + ", use one of " + strings.Join(boardColumns, ", ")), nil
+	}
+
+	var name, current string
+	err = chatTaskQuery.QueryRow(taskId).Scan(&name, &current)
+	if err == sql.ErrNoRows {
+		return ephemeralReply("There is no task " + chatTaskRef(taskId)), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &RoleRequest{
+		Entity: "task",
+		Action: "update",
+		ActiveUserId: userId,
+		TaskId: &taskId,
+	}
+
+	if !rr.Satisfied() {
+		return ephemeralReply("You can not move " + chatTaskRef(taskId)), nil
+	}
+
+	if current == status {
+		return ephemeralReply(chatTaskRef(taskId) + " *" + name + "* is already in " + status), nil
+	}
+
+	ok, message, err := moveTask(taskId, status, userId)
+	if err == sql.ErrNoRows {
+		return ephemeralReply("There is no task " + chatTaskRef(taskId)), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return ephemeralReply("Can not move " + chatTaskRef(taskId) + ": " + message), nil
+	}
+
+	return channelReply("Moved " + chatTaskRef(taskId) + " *" + name + "* to " + status), nil
+}
+
+// chatMine lists the user's open tasks, soonest due first.
+func chatMine(userId int64) (*ChatReply, error) {
+	rows, err := chatUserTasksQuery.Query(userId, chatTaskList)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	lines := make([]string, 0)
+
+	for rows.Next() {
+		var id int64
+		var name, status, projectName string
+		var dueAt sql.NullTime
+
+		err := rows.Scan(&id, &name, &status, &dueAt, &projectName)
+		if err != nil {
+			return nil, err
+		}
+
+		line := chatTaskRef(id) + " *" + name + "* " + status + " in " + projectName
+		if dueAt.Valid {
+			line += ", due " + dueAt.Time.Format("2006-01-02 15:04")
+		}
+
+		lines = append(lines, line)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return ephemeralReply("You have no open tasks"), nil
+	}
+
+	return ephemeralReply("Your open tasks:\n" + strings.Join(lines, "\n")), nil
+}
+
+// runChatCommand runs the text of a /kanelm command for a chat user, who
+// must have linked their account to act on tasks.
+func runChatCommand(teamId string, chatUserId string, text string) (*ChatReply, error) {
+	name, args := nextChatArg(text)
+	name = strings.ToLower(name)
+
+	switch name {
+	case "link":
+		return chatLink(teamId, chatUserId, args)
+	case "unlink":
+		_, err := deleteChatLinkQuery.Exec(teamId, chatUserId)
+		if err != nil {
+			return nil, err
+		}
+		return ephemeralReply("Your chat account is no longer linked to Kanelm"), nil
+	case "add", "move", "mine":
+	default:
+		return ephemeralReply(chatUsage), nil
+	}
+
+	var userId int64
+	err := chatLinkQuery.QueryRow(teamId, chatUserId).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return ephemeralReply("Your chat account is not linked to Kanelm yet. Get a code in Kanelm, then run `/kanelm link <code>`"), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "add":
+		return chatAdd(userId, args)
+	case "move":
+		return chatMove(userId, args)
+	}
+
+	return chatMine(userId)
+}
+
+// chatCommandHandler answers slash commands sent by a chat tool, signed
+// with the configured secret. It is off while no secret is set.
+func chatCommandHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if config.Chat.SigningSecret == "" {
+			http.Error(w, "Chat commands are not set up", 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxChatCommand))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+		signature := r.Header.Get("X-Slack-Signature")
+
+		if !chatSignatureValid(config.Chat.SigningSecret, timestamp, body, signature, time.Now()) {
+			http.Error(w, "Invalid signature", 401)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		reply, err := runChatCommand(form.Get("team_id"), form.Get("user_id"), form.Get("text"))
+		if err != nil {
+			log.Println("Chat command failed: " + err.Error())
+			reply = ephemeralReply("Something went wrong, please try again")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+// newChatLinkCodeHandler makes a code the active user sends with
+// /kanelm link to act as themselves from chat.
+func newChatLinkCodeHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_chat_link_code.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		code, err := randomToken()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		c := &ChatLinkCode{Code: code, ExpiresAt: time.Now().Add(chatLinkCodeTTL), Command: "/kanelm link " + code}
+
+		_, dberr := stmt.Exec(c.Code, auId, c.ExpiresAt)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(c)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestChatSignatureValid(t *testing.T) {
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	body := []byte("team_id=T1&user_id=U1&command=%2Fkanelm&text=mine")
+	now := time.Unix(1531420618, 0)
+	timestamp := "1531420618"
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+	signature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !chatSignatureValid(secret, timestamp, body, signature, now) {
+		t.Error("a correctly signed request was refused")
+	}
+
+	if chatSignatureValid(secret, timestamp, []byte("team_id=T1&user_id=U2&command=%2Fkanelm&text=mine"), signature, now) {
+		t.Error("a changed body was accepted")
+	}
+
+	if chatSignatureValid("other", timestamp, body, signature, now) {
+		t.Error("a request signed with another secret was accepted")
+	}
+
+	if chatSignatureValid(secret, timestamp, body, signature, now.Add(10 * time.Minute)) {
+		t.Error("an old request was accepted")
+	}
+
+	if chatSignatureValid(secret, "", body, signature, now) {
+		t.Error("a request without a timestamp was accepted")
+	}
+}
+
+func TestNextChatArg(t *testing.T) {
+	cases := []struct {
+		in, arg, rest string
+	}{
+		{"add Kanelm Write the docs", "add", "Kanelm Write the docs"},
+		{`"Web site" Fix the footer`, "Web site", "Fix the footer"},
+		{"  mine  ", "mine", ""},
+		{`"unclosed quote`, `"unclosed`, "quote"},
+		{"", "", ""},
+	}
+
+	for _, c := range cases {
+		arg, rest := nextChatArg(c.in)
+		if arg != c.arg || rest != c.rest {
+			t.Errorf("nextChatArg(%q) = %q, %q, want %q, %q", c.in, arg, rest, c.arg, c.rest)
+		}
+	}
+
+	status, ok := chatStatus("done")
+	if !ok || status != "Done" {
+		t.Errorf("chatStatus(done) = %q, %v", status, ok)
+	}
+
+	_, ok = chatStatus("Later")
+	if ok {
+		t.Error("an unknown status was accepted")
+	}
+}
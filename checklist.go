@@ -0,0 +1,276 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+type ChecklistItem struct {
+	Id int64 `json:"id"`
+	TaskId int64 `json:"task-id"`
+	Text string `json:"text"`
+	Done bool `json:"done"`
+	Position int64 `json:"position"`
+}
+
+type Checklist []ChecklistItem
+
+var checklistItemTaskQuery *sql.Stmt = prepareQuery("sql/get_checklist_item_task.sql")
+
+func newChecklistItemHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_checklist_item.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var item ChecklistItem
+
+		err := json.NewDecoder(r.Body).Decode(&item)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &item.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if strings.TrimSpace(item.Text) == "" {
+			http.Error(w, "Checklist item text can not be empty", 400)
+			return
+		}
+
+		item.Done = false
+
+		err = stmt.QueryRow(item.TaskId, item.Text).Scan(&item.Id, &item.Position)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&item)
+	}
+}
+
+func updateChecklistItemHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_checklist_item.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var item ChecklistItem
+
+		err := json.NewDecoder(r.Body).Decode(&item)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		err = checklistItemTaskQuery.QueryRow(item.Id).Scan(&item.TaskId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Checklist item does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &item.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if strings.TrimSpace(item.Text) == "" {
+			http.Error(w, "Checklist item text can not be empty", 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(item.Id, item.Text, item.Done, item.Position)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&item)
+	}
+}
+
+func deleteChecklistItemHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_checklist_item.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		itemId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		var taskId int64
+		err := checklistItemTaskQuery.QueryRow(itemId).Scan(&taskId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Checklist item does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &taskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(itemId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getTaskChecklistHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_task_checklist.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		checklist := make(Checklist, 0)
+
+		for rows.Next() {
+			item := ChecklistItem{}
+
+			err := rows.Scan(&item.Id, &item.TaskId, &item.Text, &item.Done, &item.Position)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			checklist = append(checklist, item)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&checklist)
+	}
+}
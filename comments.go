@@ -0,0 +1,557 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comment bodies are stored as Markdown and rendered by the client.
+type Comment struct {
+	Id int64 `json:"id"`
+	TaskId int64 `json:"task-id"`
+	ParentId *int64 `json:"parent-id"`
+	AuthorId int64 `json:"author-id"`
+	Body string `json:"body"`
+	CreatedAt time.Time `json:"created-at"`
+	UpdatedAt *time.Time `json:"updated-at"`
+	Replies Comments `json:"replies"`
+}
+
+type Comments []*Comment
+
+type NewComment struct {
+	TaskId int64 `json:"task-id"`
+	ParentId *int64 `json:"parent-id"`
+	Body string `json:"body"`
+}
+
+type CommentPage struct {
+	Comments Comments `json:"comments"`
+	Total int64 `json:"total"`
+	Limit int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+type CommentRevision struct {
+	Id int64 `json:"id"`
+	CommentId int64 `json:"comment-id"`
+	EditedBy int64 `json:"edited-by"`
+	Body string `json:"body"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type CommentRevisions []CommentRevision
+
+const maxCommentLength = 10000
+
+const defaultPageLimit = 20
+
+const maxPageLimit = 100
+
+func validCommentBody(body string) (bool, string) {
+	if strings.TrimSpace(body) == "" {
+		return false, "Comment body can not be empty"
+	}
+
+	if len(body) > maxCommentLength {
+		return false, "Comment body is longer than " + strconv.Itoa(maxCommentLength) + " characters"
+	}
+
+	return true, ""
+}
+
+// pagination reads the limit and offset url params, falling back to the
+// first page of defaultPageLimit items.
+func pagination(q url.Values) (int64, int64, error) {
+	limit := int64(defaultPageLimit)
+	offset := int64(0)
+
+	if q["limit"] != nil {
+		l, err := strconv.ParseInt(q["limit"][0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if l > 0 && l <= maxPageLimit {
+			limit = l
+		}
+	}
+
+	if q["offset"] != nil {
+		o, err := strconv.ParseInt(q["offset"][0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if o > 0 {
+			offset = o
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// threadComments nests replies under their parents. Comments must be
+// ordered so that every parent comes before its replies.
+func threadComments(comments Comments) (Comments) {
+	byId := make(map[int64]*Comment)
+	roots := make(Comments, 0)
+
+	for _, c := range comments {
+		c.Replies = make(Comments, 0)
+		byId[c.Id] = c
+
+		if c.ParentId == nil {
+			roots = append(roots, c)
+			continue
+		}
+
+		parent, ok := byId[*c.ParentId]
+		if !ok {
+			roots = append(roots, c)
+			continue
+		}
+
+		parent.Replies = append(parent.Replies, c)
+	}
+
+	return roots
+}
+
+var getCommentQuery *sql.Stmt = prepareQuery("sql/get_comment.sql")
+
+func getComment(id int64) (*Comment, error) {
+	c := &Comment{}
+	var parentId sql.NullInt64
+	var updatedAt sql.NullTime
+
+	err := getCommentQuery.QueryRow(id).Scan(&c.Id, &c.TaskId, &parentId, &c.AuthorId, &c.Body, &c.CreatedAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentId.Valid {
+		c.ParentId = &parentId.Int64
+	}
+
+	if updatedAt.Valid {
+		c.UpdatedAt = &updatedAt.Time
+	}
+
+	c.Replies = make(Comments, 0)
+
+	return c, nil
+}
+
+func newCommentHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_comment.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var nc NewComment
+
+		err := json.NewDecoder(r.Body).Decode(&nc)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		var projectId int64
+		err = taskProjectQuery.QueryRow(nc.TaskId).Scan(&projectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "comment",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+			TaskId: &nc.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validCommentBody(nc.Body)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if nc.ParentId != nil {
+			parent, err := getComment(*nc.ParentId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Parent comment does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if parent.TaskId != nc.TaskId {
+				http.Error(w, "Parent comment belongs to a different task", 400)
+				return
+			}
+		}
+
+		c := &Comment{TaskId: nc.TaskId, ParentId: nc.ParentId, AuthorId: auId, Body: nc.Body, Replies: make(Comments, 0)}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		err = tx.QueryRow(query, nc.TaskId, nc.ParentId, auId, nc.Body).Scan(&c.Id, &c.CreatedAt)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		mentioned, err := recordMentions(tx, nc.TaskId, &c.Id, nc.Body, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		// Mentioned users hear about the comment once, through the mention.
+		notifyUsers("mention", nc.TaskId, &c.Id, auId, nil, mentioned)
+		notifyWatchers("comment", nc.TaskId, &c.Id, auId, nil, mentioned)
+
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+func updateCommentHandler() func(http.ResponseWriter, *http.Request) {
+
+	revisionQuery := loadQuery("sql/new_comment_revision.sql")
+	updateQuery := loadQuery("sql/update_comment_body.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data Comment
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "comment",
+			Action: "update",
+			ActiveUserId: auId,
+			CommentId: &data.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validCommentBody(data.Body)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		_, err = tx.Exec(revisionQuery, data.Id, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		var taskId int64
+		err = tx.QueryRow(updateQuery, data.Id, data.Body).Scan(&taskId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		mentioned, err := recordMentions(tx, taskId, &data.Id, data.Body, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		notifyUsers("mention", taskId, &data.Id, auId, nil, mentioned)
+
+		c, err := getComment(data.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+func deleteCommentHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_comment.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		commentId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "comment",
+			Action: "delete",
+			ActiveUserId: auId,
+			CommentId: &commentId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(commentId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getTaskCommentsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_task_comments.sql")
+	countQuery := loadQuery("sql/count_task_comments.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		taskId, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		limit, offset, err := pagination(q)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page := &CommentPage{Limit: limit, Offset: offset}
+
+		err = db.QueryRow(countQuery, taskId).Scan(&page.Total)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(query, taskId, limit, offset)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		comments := make(Comments, 0)
+
+		for rows.Next() {
+			c := &Comment{}
+			var parentId sql.NullInt64
+			var updatedAt sql.NullTime
+
+			err := rows.Scan(&c.Id, &c.TaskId, &parentId, &c.AuthorId, &c.Body, &c.CreatedAt, &updatedAt)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if parentId.Valid {
+				id := parentId.Int64
+				c.ParentId = &id
+			}
+
+			if updatedAt.Valid {
+				t := updatedAt.Time
+				c.UpdatedAt = &t
+			}
+
+			comments = append(comments, c)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		page.Comments = threadComments(comments)
+
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+func getCommentRevisionsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_comment_revisions.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["commentid"] == nil {
+			http.Error(w, "commentid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["commentid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		revisions := make(CommentRevisions, 0)
+
+		for rows.Next() {
+			revision := CommentRevision{}
+
+			err := rows.Scan(&revision.Id, &revision.CommentId, &revision.EditedBy, &revision.Body, &revision.CreatedAt)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			revisions = append(revisions, revision)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&revisions)
+	}
+}
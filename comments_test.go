@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"net/url"
+)
+
+func TestThreadComments(t *testing.T) {
+	root := int64(1)
+	reply := int64(2)
+
+	comments := Comments{
+		&Comment{Id: 1},
+		&Comment{Id: 2, ParentId: &root},
+		&Comment{Id: 3, ParentId: &reply},
+		&Comment{Id: 4},
+	}
+
+	threads := threadComments(comments)
+
+	if len(threads) != 2 {
+		t.Fatal("There should be two root comments, there are", len(threads))
+	}
+
+	if len(threads[0].Replies) != 1 || threads[0].Replies[0].Id != 2 {
+		t.Fatal("Comment 2 should be the only reply to comment 1")
+	}
+
+	if len(threads[0].Replies[0].Replies) != 1 || threads[0].Replies[0].Replies[0].Id != 3 {
+		t.Fatal("Comment 3 should be nested under comment 2")
+	}
+
+	if len(threads[1].Replies) != 0 {
+		t.Fatal("Comment 4 should not have replies")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	limit, offset, err := pagination(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limit != defaultPageLimit || offset != 0 {
+		t.Fatal("Empty params should give the first default page, got", limit, offset)
+	}
+
+	limit, offset, err = pagination(url.Values{"limit": {"5"}, "offset": {"10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limit != 5 || offset != 10 {
+		t.Fatal("Limit and offset should be 5 and 10, got", limit, offset)
+	}
+
+	limit, _, _ = pagination(url.Values{"limit": {"1000"}})
+	if limit != defaultPageLimit {
+		t.Fatal("Limit above the maximum should fall back to the default, got", limit)
+	}
+
+	_, _, err = pagination(url.Values{"offset": {"abc"}})
+	if err == nil {
+		t.Fatal("Non numeric offset should be an error")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"log"
+	"os"
+)
+
+type S3Config struct {
+	Endpoint string `toml:"endpoint"`
+	Region string `toml:"region"`
+	Bucket string `toml:"bucket"`
+	AccessKey string `toml:"access-key"`
+	SecretKey string `toml:"secret-key"`
+}
+
+type AttachmentConfig struct {
+	MaxSize int64 `toml:"max-size"`
+	AllowedTypes []string `toml:"allowed-types"`
+	Store string `toml:"store"`
+	Dir string `toml:"dir"`
+	S3 S3Config `toml:"s3"`
+}
+
+// TrashConfig controls how long soft deleted projects and tasks stay
+// restorable. Retention is a duration like 720h or a number of days like 30d.
+type TrashConfig struct {
+	Retention string `toml:"retention"`
+	PurgeSchedule string `toml:"purge-schedule"`
+}
+
+// RecurringConfig controls how often recurring task templates that are due
+// are looked for.
+type RecurringConfig struct {
+	Schedule string `toml:"schedule"`
+}
+
+// NotificationConfig controls the due date notifications. DueSoon is how
+// long before a task's due date its assignees and watchers are told, and
+// EscalateAfter how long a task may stay overdue before its project owners
+// are.
+type NotificationConfig struct {
+	DueSoon string `toml:"due-soon"`
+	EscalateAfter string `toml:"escalate-after"`
+	Schedule string `toml:"schedule"`
+}
+
+type SMTPConfig struct {
+	Host string `toml:"host"`
+	Port int `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// MailConfig controls notification emails. Mailer is smtp, spool, which
+// writes each message to a file in SpoolDir, or none. BaseURL is where links
+// in emails point.
+type MailConfig struct {
+	Mailer string `toml:"mailer"`
+	From string `toml:"from"`
+	BaseURL string `toml:"base-url"`
+	SpoolDir string `toml:"spool-dir"`
+	Schedule string `toml:"schedule"`
+	DigestSchedule string `toml:"digest-schedule"`
+	SMTP SMTPConfig `toml:"smtp"`
+}
+
+// WebhookConfig controls delivering outgoing webhooks. A delivery is tried
+// MaxAttempts times, waiting twice as long after each failure.
+type WebhookConfig struct {
+	Schedule string `toml:"schedule"`
+	MaxAttempts int `toml:"max-attempts"`
+	Timeout string `toml:"timeout"`
+}
+
+// AutomationConfig controls when due-date-passed rules are checked.
+type AutomationConfig struct {
+	Schedule string `toml:"schedule"`
+}
+
+// ChatConfig holds the signing secret of the chat app that sends slash
+// commands. Chat commands are off while it is empty.
+type ChatConfig struct {
+	SigningSecret string `toml:"signing-secret"`
+}
+
+type Config struct {
+	Attachments AttachmentConfig `toml:"attachments"`
+	Trash TrashConfig `toml:"trash"`
+	Recurring RecurringConfig `toml:"recurring"`
+	Notifications NotificationConfig `toml:"notifications"`
+	Mail MailConfig `toml:"mail"`
+	Webhooks WebhookConfig `toml:"webhooks"`
+	Automation AutomationConfig `toml:"automation"`
+	Chat ChatConfig `toml:"chat"`
+}
+
+func defaultConfig() (*Config) {
+	return &Config{
+		Attachments: AttachmentConfig{
+			MaxSize: 10 << 20,
+			AllowedTypes: []string{"image/*", "text/plain", "application/pdf"},
+			Store: "local",
+			Dir: "data/attachments",
+		},
+		Trash: TrashConfig{
+			Retention: "30d",
+			PurgeSchedule: "@every 1h",
+		},
+		Recurring: RecurringConfig{
+			Schedule: "@every 1m",
+		},
+		Notifications: NotificationConfig{
+			DueSoon: "24h",
+			EscalateAfter: "48h",
+			Schedule: "@every 15m",
+		},
+		Mail: MailConfig{
+			Mailer: "none",
+			From: "kanelm@localhost",
+			BaseURL: "http://localhost:8080",
+			SpoolDir: "data/mail",
+			Schedule: "@every 1m",
+			DigestSchedule: "0 0 7 * * *",
+			SMTP: SMTPConfig{
+				Host: "localhost",
+				Port: 25,
+			},
+		},
+		Webhooks: WebhookConfig{
+			Schedule: "@every 10s",
+			MaxAttempts: 8,
+			Timeout: "10s",
+		},
+		Automation: AutomationConfig{
+			Schedule: "@every 1m",
+		},
+	}
+}
+
+// loadConfig reads server settings over the defaults. A missing file
+// leaves every setting at its default.
+func loadConfig(filename string) (*Config) {
+	c := defaultConfig()
+
+	_, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return c
+	}
+
+	if _, err := toml.DecodeFile(filename, c); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return c
+}
+
+var config *Config = loadConfig("config.toml")
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"log"
+	"errors"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CustomField is a typed piece of metadata a project adds to its tasks.
+// Options lists the choices of single-select and multi-select fields.
+type CustomField struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Options []string `json:"options"`
+}
+
+type CustomFields []CustomField
+
+// CustomValues holds the values of a task's custom fields keyed by field id.
+type CustomValues map[int64]json.RawMessage
+
+type TaskCustomValue struct {
+	TaskId int64 `json:"task-id"`
+	FieldId int64 `json:"field-id"`
+	Value json.RawMessage `json:"value"`
+}
+
+const maxCustomTextLength = 1000
+
+var customFieldKinds = toSet([]string{"text", "number", "date", "single-select", "multi-select", "user"})
+
+func validCustomField(f *CustomField) (bool, string) {
+	if strings.TrimSpace(f.Name) == "" {
+		return false, "Custom field name can not be empty"
+	}
+
+	if !customFieldKinds.Has(f.Kind) {
+		return false, "Custom field kind must be one of text, number, date, single-select, multi-select or user"
+	}
+
+	selectable := f.Kind == "single-select" || f.Kind == "multi-select"
+
+	if selectable && len(f.Options) == 0 {
+		return false, "Select fields need at least one option"
+	}
+
+	if !selectable && len(f.Options) > 0 {
+		return false, "Only select fields can have options"
+	}
+
+	seen := make(set)
+	for _, o := range f.Options {
+		if strings.TrimSpace(o) == "" {
+			return false, "Select options can not be empty"
+		}
+
+		if seen.Has(o) {
+			return false, "Select option " + o + " is listed twice"
+		}
+
+		seen.Add(o)
+	}
+
+	return true, ""
+}
+
+// normalizeCustomValue checks a raw json value against the kind of its field
+// and returns it re-encoded. User values are only checked to be ids here.
+func normalizeCustomValue(f *CustomField, raw json.RawMessage) (json.RawMessage, error) {
+	switch f.Kind {
+	case "text":
+		var v string
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errors.New(f.Name + " must be a string")
+		}
+
+		if len(v) > maxCustomTextLength {
+			return nil, errors.New(f.Name + " is longer than " + strconv.Itoa(maxCustomTextLength) + " characters")
+		}
+
+		return json.Marshal(v)
+
+	case "number":
+		var v float64
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errors.New(f.Name + " must be a number")
+		}
+
+		return json.Marshal(v)
+
+	case "date":
+		var v string
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errors.New(f.Name + " must be a date like 2006-01-02")
+		}
+
+		_, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return nil, errors.New(f.Name + " must be a date like 2006-01-02")
+		}
+
+		return json.Marshal(v)
+
+	case "single-select":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || !toSet(f.Options).Has(v) {
+			return nil, errors.New(f.Name + " must be one of " + strings.Join(f.Options, ", "))
+		}
+
+		return json.Marshal(v)
+
+	case "multi-select":
+		var v []string
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errors.New(f.Name + " must be a list of options")
+		}
+
+		options := toSet(f.Options)
+		chosen := make(set)
+		values := make([]string, 0, len(v))
+
+		for _, o := range v {
+			if !options.Has(o) {
+				return nil, errors.New(o + " is not an option of " + f.Name)
+			}
+
+			if !chosen.Has(o) {
+				chosen.Add(o)
+				values = append(values, o)
+			}
+		}
+
+		return json.Marshal(values)
+
+	case "user":
+		var v int64
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errors.New(f.Name + " must be a user id")
+		}
+
+		return json.Marshal(v)
+	}
+
+	return nil, errors.New("Unknown custom field kind " + f.Kind)
+}
+
+func scanCustomField(row rowScanner) (CustomField, error) {
+	f := CustomField{}
+	var options []byte
+
+	err := row.Scan(&f.Id, &f.ProjectId, &f.Name, &f.Kind, &options)
+	if err != nil {
+		return f, err
+	}
+
+	err = json.Unmarshal(options, &f.Options)
+	return f, err
+}
+
+var getCustomFieldQuery *sql.Stmt = prepareQuery("sql/get_custom_field.sql")
+
+func getCustomField(id int64) (*CustomField, error) {
+	f, err := scanCustomField(getCustomFieldQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+var projectCustomFieldsQuery *sql.Stmt = prepareQuery("sql/get_project_custom_fields.sql")
+
+func projectCustomFields(projectId int64) (CustomFields, error) {
+	rows, err := projectCustomFieldsQuery.Query(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	fields := make(CustomFields, 0)
+
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, rows.Err()
+}
+
+var projectCustomValuesQuery *sql.Stmt = prepareQuery("sql/get_project_custom_values.sql")
+
+// projectCustomValues returns the custom field values of every task in a project keyed by task id.
+func projectCustomValues(projectId int64) (map[int64]CustomValues, error) {
+	rows, err := projectCustomValuesQuery.Query(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	values := make(map[int64]CustomValues)
+
+	for rows.Next() {
+		var taskId, fieldId int64
+		var value []byte
+
+		err := rows.Scan(&taskId, &fieldId, &value)
+		if err != nil {
+			return nil, err
+		}
+
+		if values[taskId] == nil {
+			values[taskId] = make(CustomValues)
+		}
+
+		values[taskId][fieldId] = json.RawMessage(value)
+	}
+
+	return values, rows.Err()
+}
+
+func newCustomFieldHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_custom_field.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var f CustomField
+
+		err := json.NewDecoder(r.Body).Decode(&f)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "field",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &f.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if f.Options == nil {
+			f.Options = make([]string, 0)
+		}
+
+		ok, message = validCustomField(&f)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		options, _ := json.Marshal(f.Options)
+
+		err = stmt.QueryRow(f.ProjectId, f.Name, f.Kind, string(options)).Scan(&f.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&f)
+	}
+}
+
+// updateCustomFieldHandler renames a field and replaces its options. The
+// kind of a field is fixed once it is created so stored values stay valid.
+func updateCustomFieldHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_custom_field.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var f CustomField
+
+		err := json.NewDecoder(r.Body).Decode(&f)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getCustomField(f.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Custom field does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "field",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		f.ProjectId = current.ProjectId
+		f.Kind = current.Kind
+
+		if f.Options == nil {
+			f.Options = make([]string, 0)
+		}
+
+		ok, message = validCustomField(&f)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		options, _ := json.Marshal(f.Options)
+
+		_, dberr := stmt.Exec(f.Id, f.Name, string(options))
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&f)
+	}
+}
+
+func deleteCustomFieldHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_custom_field.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		fieldId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		f, err := getCustomField(fieldId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Custom field does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "field",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &f.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(fieldId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getProjectCustomFieldsHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		fields, err := projectCustomFields(id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&fields)
+	}
+}
+
+var checkUserExistsQuery *sql.Stmt = prepareQuery("sql/check_user_exists.sql")
+
+// setTaskCustomValueHandler stores the value of one custom field on a task.
+// A null value clears the field.
+func setTaskCustomValueHandler() func(http.ResponseWriter, *http.Request) {
+
+	setQuery := loadQuery("sql/set_task_custom_value.sql")
+	setStmt, err := db.Prepare(setQuery)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	deleteQuery := loadQuery("sql/delete_task_custom_value.sql")
+	deleteStmt, err := db.Prepare(deleteQuery)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var tv TaskCustomValue
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&tv)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		var projectId int64
+		err := taskProjectQuery.QueryRow(tv.TaskId).Scan(&projectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+			TaskId: &tv.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		f, err := getCustomField(tv.FieldId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Custom field does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if f.ProjectId != projectId {
+			http.Error(w, "Custom field belongs to a different project", 400)
+			return
+		}
+
+		if len(tv.Value) == 0 || string(tv.Value) == "null" {
+			_, dberr := deleteStmt.Exec(tv.TaskId, tv.FieldId, auId)
+			if dberr != nil {
+				http.Error(w, dberr.Error(), 500)
+				return
+			}
+
+			publishTaskEvent("task.updated", tv.TaskId, auId, &Change{"custom-field:" + strconv.FormatInt(tv.FieldId, 10), nil})
+			return
+		}
+
+		value, err := normalizeCustomValue(f, tv.Value)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if f.Kind == "user" {
+			var userId int64
+			json.Unmarshal(value, &userId)
+
+			var exists bool
+			err := checkUserExistsQuery.QueryRow(userId).Scan(&exists)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if !exists {
+				http.Error(w, "User does not exist", 400)
+				return
+			}
+		}
+
+		_, dberr := setStmt.Exec(tv.TaskId, tv.FieldId, string(value), auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", tv.TaskId, auId, &Change{"custom-field:" + strconv.FormatInt(tv.FieldId, 10), value})
+
+		tv.Value = value
+
+		json.NewEncoder(w).Encode(&tv)
+	}
+}
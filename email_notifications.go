@@ -0,0 +1,442 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailSettings are a user's email preferences. Assignment and mention
+// notifications are emailed unless turned off, the daily digest of due and
+// overdue tasks is opt in.
+type EmailSettings struct {
+	Email string `json:"email"`
+	Assignments bool `json:"assignments"`
+	Mentions bool `json:"mentions"`
+	Digest bool `json:"digest"`
+}
+
+// unsubscribeKinds are the emails an unsubscribe link can turn off.
+var unsubscribeKinds = toSet([]string{"assignments", "mentions", "digest", "all"})
+
+// unsubscribeLink lets a recipient turn off one kind of email without
+// logging in.
+func unsubscribeLink(token string, kind string) (string) {
+	return strings.TrimRight(config.Mail.BaseURL, "/") + "/unsubscribe?" + url.Values{"token": {token}, "kind": {kind}}.Encode()
+}
+
+// taskLink opens the board of a task's project as the recipient.
+func taskLink(projectId int64, projectName string, userId int64, userName string) (string) {
+	q := url.Values{
+		"projectid": {strconv.FormatInt(projectId, 10)},
+		"projectname": {projectName},
+		"userid": {strconv.FormatInt(userId, 10)},
+		"username": {userName},
+	}
+	return strings.TrimRight(config.Mail.BaseURL, "/") + "/tasks?" + q.Encode()
+}
+
+func unsubscribeHeaders(token string, kind string) (map[string]string) {
+	return map[string]string{
+		"List-Unsubscribe": "<" + unsubscribeLink(token, kind) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// NotificationEmail is a notification waiting to be emailed.
+type NotificationEmail struct {
+	Id int64
+	Kind string
+	Email string
+	Token string
+	UserId int64
+	UserName string
+	TaskName string
+	ProjectId int64
+	ProjectName string
+	ActorName string
+}
+
+func (n *NotificationEmail) Mail() (*Mail) {
+	actor := n.ActorName
+	if actor == "" {
+		actor = "Someone"
+	}
+
+	m := &Mail{To: n.Email}
+	kind := "mentions"
+
+	if n.Kind == "assignment" {
+		kind = "assignments"
+		m.Subject = "[" + n.ProjectName + "] You were assigned to " + n.TaskName
+		m.Body = actor + " assigned you to " + n.TaskName + " in " + n.ProjectName + ".\n"
+	} else {
+		m.Subject = "[" + n.ProjectName + "] " + actor + " mentioned you on " + n.TaskName
+		m.Body = actor + " mentioned you on " + n.TaskName + " in " + n.ProjectName + ".\n"
+	}
+
+	m.Body += "\n" + taskLink(n.ProjectId, n.ProjectName, n.UserId, n.UserName) + "\n" +
+		"\nTo stop these emails, visit " + unsubscribeLink(n.Token, kind) + "\n"
+	m.Headers = unsubscribeHeaders(n.Token, kind)
+
+	return m
+}
+
+// DigestTask is an open task of the digest, due today or overdue.
+type DigestTask struct {
+	Id int64
+	Name string
+	Status string
+	DueAt time.Time
+	ProjectId int64
+	ProjectName string
+}
+
+// digestMail lists the tasks of a daily digest, overdue ones first.
+func digestMail(email string, token string, userId int64, userName string, tasks []DigestTask, now time.Time) (*Mail) {
+	var overdue, today strings.Builder
+
+	for _, t := range tasks {
+		line := "- " + t.Name + " (" + t.ProjectName + ", " + t.Status + ", due " + t.DueAt.Format("Jan 2 15:04") + ")\n" +
+			"  " + taskLink(t.ProjectId, t.ProjectName, userId, userName) + "\n"
+
+		if t.DueAt.Before(now) {
+			overdue.WriteString(line)
+		} else {
+			today.WriteString(line)
+		}
+	}
+
+	body := ""
+
+	if overdue.Len() > 0 {
+		body += "Overdue:\n" + overdue.String() + "\n"
+	}
+
+	if today.Len() > 0 {
+		body += "Due today:\n" + today.String() + "\n"
+	}
+
+	body += "To stop the daily digest, visit " + unsubscribeLink(token, "digest") + "\n"
+
+	return &Mail{
+		To: email,
+		Subject: "Your tasks for " + now.Format("Monday, Jan 2"),
+		Body: body,
+		Headers: unsubscribeHeaders(token, "digest"),
+	}
+}
+
+var claimEmailsQuery string = loadQuery("sql/claim_notification_emails.sql")
+
+var releaseEmailQuery string = loadQuery("sql/release_notification_email.sql")
+
+// emailWindow is how old a notification may get and still be emailed, so a
+// server coming back from a long outage does not send a backlog.
+const emailWindow = 24 * time.Hour
+
+// sendNotificationEmails emails the unread assignment and mention
+// notifications of users who want them. Notifications are claimed by marking
+// them emailed before they are sent, so one is never sent twice by two
+// servers and no lock is held while mail is sent. A failed send is released
+// and retried on the next run.
+func sendNotificationEmails(now time.Time) (error) {
+	rows, err := db.Query(claimEmailsQuery, now.Add(-emailWindow), now)
+	if err != nil {
+		return err
+	}
+
+	emails := make([]NotificationEmail, 0)
+
+	for rows.Next() {
+		n := NotificationEmail{}
+		var actorName sql.NullString
+
+		err := rows.Scan(&n.Id, &n.Kind, &n.Email, &n.Token, &n.UserId, &n.UserName, &n.TaskName, &n.ProjectId, &n.ProjectName, &actorName)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		n.ActorName = actorName.String
+		emails = append(emails, n)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for i := range emails {
+		err := mailer.Send(emails[i].Mail())
+		if err != nil {
+			log.Println("Failed to email notification " + strconv.FormatInt(emails[i].Id, 10) + ": " + err.Error())
+
+			_, err := db.Exec(releaseEmailQuery, emails[i].Id, now)
+			if err != nil {
+				log.Println("Failed to release notification " + strconv.FormatInt(emails[i].Id, 10) + ": " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+var claimDigestRecipientsQuery string = loadQuery("sql/claim_digest_recipients.sql")
+
+var digestTasksQuery string = loadQuery("sql/get_digest_tasks.sql")
+
+var releaseDigestQuery string = loadQuery("sql/release_digest.sql")
+
+// sendDigests emails each user who asked for it the open tasks assigned to
+// them that are overdue or due by the end of the day. A user gets at most one
+// digest a day, however often the job runs or the server restarts. Recipients
+// are claimed by marking their digest sent before it is mailed, so no lock is
+// held while mail is sent, and a digest that fails is released for the next
+// run.
+func sendDigests(now time.Time) (error) {
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	rows, err := db.Query(claimDigestRecipientsQuery, dayStart, now)
+	if err != nil {
+		return err
+	}
+
+	type recipient struct {
+		userId int64
+		email string
+		token string
+		name string
+		lastSentAt sql.NullTime
+	}
+
+	recipients := make([]recipient, 0)
+
+	for rows.Next() {
+		r := recipient{}
+
+		err := rows.Scan(&r.userId, &r.email, &r.token, &r.name, &r.lastSentAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		tasks, err := digestTasks(db, r.userId, dayEnd)
+
+		if err == nil && len(tasks) > 0 {
+			err = mailer.Send(digestMail(r.email, r.token, r.userId, r.name, tasks, now))
+		}
+
+		if err != nil {
+			log.Println("Failed to email digest to user " + strconv.FormatInt(r.userId, 10) + ": " + err.Error())
+
+			_, err := db.Exec(releaseDigestQuery, r.userId, now, r.lastSentAt)
+			if err != nil {
+				log.Println("Failed to release digest of user " + strconv.FormatInt(r.userId, 10) + ": " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+func digestTasks(q queryer, userId int64, until time.Time) ([]DigestTask, error) {
+	rows, err := q.Query(digestTasksQuery, userId, until)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tasks := make([]DigestTask, 0)
+
+	for rows.Next() {
+		t := DigestTask{}
+
+		err := rows.Scan(&t.Id, &t.Name, &t.Status, &t.DueAt, &t.ProjectId, &t.ProjectName)
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	return tasks, rows.Err()
+}
+
+// emailNotifier schedules sending notification emails and daily digests.
+func emailNotifier() {
+	err := scheduler.AddFunc(config.Mail.Schedule, func() {
+		err := sendNotificationEmails(time.Now())
+		if err != nil {
+			log.Println("Failed to send notification emails: " + err.Error())
+		}
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = scheduler.AddFunc(config.Mail.DigestSchedule, func() {
+		err := sendDigests(time.Now())
+		if err != nil {
+			log.Println("Failed to send digests: " + err.Error())
+		}
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+func getEmailSettingsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_email_settings.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		s := &EmailSettings{Assignments: true, Mentions: true}
+
+		err := db.QueryRow(query, auId).Scan(&s.Email, &s.Assignments, &s.Mentions, &s.Digest)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(s)
+	}
+}
+
+// updateEmailSettingsHandler saves the active user's email address and
+// preferences. An empty address turns every email off.
+func updateEmailSettingsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/set_email_settings.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var s EmailSettings
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&s)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		s.Email = strings.TrimSpace(s.Email)
+
+		if s.Email == "" {
+			s.Assignments = false
+			s.Mentions = false
+			s.Digest = false
+		} else {
+			addr, err := mail.ParseAddress(s.Email)
+			if err != nil {
+				http.Error(w, "Invalid email address", 400)
+				return
+			}
+
+			s.Email = addr.Address
+		}
+
+		token, err := randomToken()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		_, dberr := stmt.Exec(auId, s.Email, s.Assignments, s.Mentions, s.Digest, token)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&s)
+	}
+}
+
+// unsubscribeHandler serves the links in emails. It needs no login, the
+// token stands for the user, and takes POST too for one click unsubscribe.
+func unsubscribeHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/unsubscribe_email.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		q := r.URL.Query()
+
+		token := q.Get("token")
+		kind := q.Get("kind")
+
+		if kind == "" {
+			kind = "all"
+		}
+
+		if token == "" || !unsubscribeKinds.Has(kind) {
+			http.Error(w, "Invalid unsubscribe link", 400)
+			return
+		}
+
+		res, dberr := stmt.Exec(token, kind)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			http.Error(w, "Invalid unsubscribe link", 404)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("You have been unsubscribed.\n"))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+)
+
+// Event is a change to a project or task, published once it is saved.
+// Type is one of eventTypes. Data describes the change: the new task for
+// task.created, the changed field and its new value for task.updated and
+// project.updated, and the assigned user for task.assigned. Rules are the
+// automation rules whose actions led to the event, see runRule.
+type Event struct {
+	Type string `json:"event"`
+	ProjectId int64 `json:"project-id"`
+	TaskId *int64 `json:"task-id,omitempty"`
+	ActorId int64 `json:"actor-id"`
+	Data interface{} `json:"data,omitempty"`
+	At time.Time `json:"at"`
+	Rules []int64 `json:"-"`
+}
+
+var eventTypes = toSet([]string{
+	"task.created",
+	"task.updated",
+	"task.deleted",
+	"task.assigned",
+	"project.updated",
+	"project.deleted",
+})
+
+// Change is the data of an update event. Value is what the field was set to,
+// or for labels and assignees the id added or removed.
+type Change struct {
+	Field string `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+// eventListeners are called in order with every published event. They run
+// on the request goroutine after the change is committed and should hand
+// slow work off.
+var eventListeners []func(*Event)
+
+func listen(f func(*Event)) {
+	eventListeners = append(eventListeners, f)
+}
+
+func publish(e *Event) {
+	e.At = time.Now()
+	for _, f := range eventListeners {
+		f(e)
+	}
+}
+
+// publishTaskEvent publishes an event about a task, looking up its project.
+func publishTaskEvent(eventType string, taskId int64, actorId int64, data interface{}) {
+	if len(eventListeners) == 0 {
+		return
+	}
+
+	var projectId int64
+	err := taskProjectQuery.QueryRow(taskId).Scan(&projectId)
+	if err != nil {
+		log.Println("Failed to publish " + eventType + " of task " + strconv.FormatInt(taskId, 10) + ": " + err.Error())
+		return
+	}
+
+	publish(&Event{Type: eventType, ProjectId: projectId, TaskId: &taskId, ActorId: actorId, Data: data})
+}
+
+func publishProjectEvent(eventType string, projectId int64, actorId int64, data interface{}) {
+	publish(&Event{Type: eventType, ProjectId: projectId, ActorId: actorId, Data: data})
+}
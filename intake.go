@@ -0,0 +1,921 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Intake turns what is posted to /intake with its token into tasks of its
+// project, created as the user who set it up. JSON payloads, say from an
+// alerting system, and raw emails sent as message/rfc822 are both mapped
+// to a task by Mapping.
+type Intake struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Token string `json:"token"`
+	Mapping IntakeMapping `json:"mapping"`
+	Active *bool `json:"active"`
+	CreatedBy int64 `json:"created-by"`
+}
+
+type Intakes []Intake
+
+// IntakeMapping says where the fields of a new task are in a payload. Each
+// is a dotted path, such as alert.labels.severity or items.0.id, into the
+// JSON payload, or for emails one of subject, from, from-address, to, cc,
+// date, message-id and body. Title, Description and ExternalId default to
+// title, description and id, or subject, body and message-id for emails.
+//
+// Labels points at a label name or a list of them, names the project does
+// not have are left out. Assignee points at a user name or email address.
+// LabelIds are added to every task and AssigneeId is assigned when the
+// payload names nobody known.
+type IntakeMapping struct {
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Labels string `json:"labels"`
+	Assignee string `json:"assignee"`
+	ExternalId string `json:"external-id"`
+	LabelIds []int64 `json:"label-ids"`
+	AssigneeId *int64 `json:"assignee-id"`
+}
+
+// IntakeResult answers an intake request. Duplicate is set when an earlier
+// payload had the same external id, TaskId is then the task it created.
+type IntakeResult struct {
+	TaskId *int64 `json:"task-id"`
+	Duplicate bool `json:"duplicate"`
+}
+
+// intakeItem is a payload mapped to the fields of a task.
+type intakeItem struct {
+	Title string
+	Description string
+	Labels []string
+	Assignee string
+	ExternalId string
+}
+
+var jsonIntakeDefaults = IntakeMapping{Title: "title", Description: "description", ExternalId: "id"}
+
+var emailIntakeDefaults = IntakeMapping{Title: "subject", Description: "body", ExternalId: "message-id"}
+
+// maxIntakePayload is the largest payload or email accepted.
+const maxIntakePayload = 1 << 20
+
+// minIntakeToken is the shortest token a client may choose for an intake.
+const minIntakeToken = 20
+
+func validIntakePath(path string) (bool) {
+	if path == "" {
+		return true
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validIntake(in *Intake) (bool, string) {
+	if strings.TrimSpace(in.Name) == "" {
+		return false, "Intake name can not be empty"
+	}
+
+	if in.Token != "" && len(in.Token) < minIntakeToken {
+		return false, "Intake token must be at least " + strconv.Itoa(minIntakeToken) + " characters"
+	}
+
+	m := in.Mapping
+	for _, path := range []string{m.Title, m.Description, m.Labels, m.Assignee, m.ExternalId} {
+		if !validIntakePath(path) {
+			return false, "Invalid mapping path " + path
+		}
+	}
+
+	return true, ""
+}
+
+// checkIntake validates an intake and checks its preset labels belong to
+// its project and its preset assignee exists.
+func checkIntake(in *Intake) (bool, string, error) {
+	ok, message := validIntake(in)
+	if !ok {
+		return false, message, nil
+	}
+
+	for _, labelId := range in.Mapping.LabelIds {
+		var projectId int64
+		err := labelProjectQuery.QueryRow(labelId).Scan(&projectId)
+		if err == sql.ErrNoRows || (err == nil && projectId != in.ProjectId) {
+			return false, "Label " + strconv.FormatInt(labelId, 10) + " does not belong to the project", nil
+		}
+
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	if in.Mapping.AssigneeId != nil {
+		var exists bool
+		err := checkUserExistsQuery.QueryRow(*in.Mapping.AssigneeId).Scan(&exists)
+		if err != nil {
+			return false, "", err
+		}
+
+		if !exists {
+			return false, "User " + strconv.FormatInt(*in.Mapping.AssigneeId, 10) + " does not exist", nil
+		}
+	}
+
+	return true, "", nil
+}
+
+// lookupPath follows a dotted path through objects and, by index, arrays.
+func lookupPath(payload interface{}, path string) (interface{}, bool) {
+	v := payload
+
+	for _, part := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// pathString is a payload value as text. Objects and arrays are written as
+// JSON so nothing is lost from a description.
+func pathString(v interface{}) (string) {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return string(b)
+}
+
+// pathStrings is a payload value that is a string or a list of them.
+func pathStrings(v interface{}) ([]string) {
+	values := make([]string, 0)
+
+	switch value := v.(type) {
+	case []interface{}:
+		for _, item := range value {
+			s := strings.TrimSpace(pathString(item))
+			if s != "" {
+				values = append(values, s)
+			}
+		}
+	default:
+		s := strings.TrimSpace(pathString(value))
+		if s != "" {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) (string) {
+	if len(s) <= n {
+		return s
+	}
+
+	s = s[:n]
+	for !utf8.ValidString(s) {
+		s = s[:len(s) - 1]
+	}
+
+	return s
+}
+
+// mapIntake picks the fields of a task out of a payload. A title is
+// required, descriptions longer than tasks allow are cut short.
+func mapIntake(m *IntakeMapping, payload map[string]interface{}, email bool) (*intakeItem, string) {
+	defaults := jsonIntakeDefaults
+	if email {
+		defaults = emailIntakeDefaults
+	}
+
+	pick := func(path string, fallback string) (interface{}) {
+		if path == "" {
+			path = fallback
+		}
+
+		if path == "" {
+			return nil
+		}
+
+		v, _ := lookupPath(payload, path)
+		return v
+	}
+
+	item := &intakeItem{}
+
+	item.Title = strings.Join(strings.Fields(pathString(pick(m.Title, defaults.Title))), " ")
+	if item.Title == "" {
+		return nil, "Payload has no title"
+	}
+
+	item.Description = truncate(strings.TrimSpace(pathString(pick(m.Description, defaults.Description))), maxDescriptionLength)
+	item.Labels = pathStrings(pick(m.Labels, defaults.Labels))
+	item.Assignee = strings.TrimSpace(pathString(pick(m.Assignee, defaults.Assignee)))
+	item.ExternalId = strings.TrimSpace(pathString(pick(m.ExternalId, defaults.ExternalId)))
+
+	if address, err := mail.ParseAddress(item.Assignee); err == nil {
+		item.Assignee = address.Address
+	}
+
+	return item, ""
+}
+
+// emailPayload reads an RFC 5322 message into the fields intake mappings
+// refer to. The body is the text of the message, or of its first text/plain
+// part.
+func emailPayload(r io.Reader) (map[string]interface{}, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := new(mime.WordDecoder)
+
+	header := func(name string) (string) {
+		value := msg.Header.Get(name)
+		decoded, err := decoder.DecodeHeader(value)
+		if err != nil {
+			return value
+		}
+		return decoded
+	}
+
+	body, err := emailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]interface{}{
+		"subject": header("Subject"),
+		"from": header("From"),
+		"to": header("To"),
+		"cc": header("Cc"),
+		"date": msg.Header.Get("Date"),
+		"message-id": strings.Trim(msg.Header.Get("Message-Id"), "<> "),
+		"body": body,
+	}
+
+	if from, err := msg.Header.AddressList("From"); err == nil && len(from) > 0 {
+		payload["from-address"] = from[0].Address
+	}
+
+	return payload, nil
+}
+
+func emailText(contentType string, encoding string, body io.Reader) (string, error) {
+	mediaType := "text/plain"
+	params := make(map[string]string)
+
+	if contentType != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+
+			if err != nil {
+				return "", err
+			}
+
+			text, err := emailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil || text != "" {
+				return text, err
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	text, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Replace(string(text), "\r\n", "\n", -1), nil
+}
+
+func scanIntake(row rowScanner) (Intake, error) {
+	in := Intake{}
+	var mapping []byte
+	var active bool
+
+	err := row.Scan(&in.Id, &in.ProjectId, &in.Name, &in.Token, &mapping, &active, &in.CreatedBy)
+	if err != nil {
+		return in, err
+	}
+
+	in.Active = &active
+
+	err = json.Unmarshal(mapping, &in.Mapping)
+	return in, err
+}
+
+var getIntakeQuery *sql.Stmt = prepareQuery("sql/get_intake.sql")
+
+func getIntake(id int64) (*Intake, error) {
+	in, err := scanIntake(getIntakeQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &in, nil
+}
+
+var intakeByTokenQuery *sql.Stmt = prepareQuery("sql/get_intake_by_token.sql")
+
+var intakeLabelsQuery *sql.Stmt = prepareQuery("sql/find_intake_labels.sql")
+
+var intakeAssigneeQuery *sql.Stmt = prepareQuery("sql/find_intake_assignee.sql")
+
+var newIntakeItemQuery string = loadQuery("sql/new_intake_item.sql")
+
+var intakeItemTaskQuery string = loadQuery("sql/get_intake_item_task.sql")
+
+var updateIntakeItemTaskQuery string = loadQuery("sql/update_intake_item_task.sql")
+
+var intakeAssignQuery string = loadQuery("sql/new_task_assignee.sql")
+
+var intakeLabelQuery string = loadQuery("sql/new_task_label.sql")
+
+// intakeLabels finds the project labels an item names and the intake's
+// preset ones.
+func intakeLabels(in *Intake, names []string) (Labels, error) {
+	namesJSON, _ := json.Marshal(names)
+
+	labelIds := in.Mapping.LabelIds
+	if labelIds == nil {
+		labelIds = make([]int64, 0)
+	}
+
+	idsJSON, _ := json.Marshal(labelIds)
+
+	rows, err := intakeLabelsQuery.Query(in.ProjectId, string(namesJSON), string(idsJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	labels := make(Labels, 0)
+
+	for rows.Next() {
+		var l Label
+		err := rows.Scan(&l.Id, &l.ProjectId, &l.Name, &l.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		labels = append(labels, l)
+	}
+
+	return labels, rows.Err()
+}
+
+// intakeAssignee finds the user an item names, falling back to the intake's
+// preset assignee.
+func intakeAssignee(in *Intake, name string) (*int64, error) {
+	if name != "" {
+		var id int64
+		err := intakeAssigneeQuery.QueryRow(name).Scan(&id)
+		if err == nil {
+			return &id, nil
+		}
+
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	return in.Mapping.AssigneeId, nil
+}
+
+// intakeHandler creates a task from a payload posted with an intake token.
+// Payloads with an external id already seen return the task created the
+// first time instead, so senders may safely retry.
+func intakeHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", 405)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = r.Header.Get("X-Kanelm-Intake-Token")
+		}
+
+		in, err := scanIntake(intakeByTokenQuery.QueryRow(token))
+		if err == sql.ErrNoRows || (err == nil && !*in.Active) {
+			http.Error(w, "Intake does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		var deleted bool
+		err = projectTrashStateQuery.QueryRow(in.ProjectId).Scan(&deleted)
+		if err == sql.ErrNoRows || (err == nil && deleted) {
+			http.Error(w, "Intake does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxIntakePayload)
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		email := mediaType == "message/rfc822"
+
+		var payload map[string]interface{}
+
+		if email {
+			payload, err = emailPayload(body)
+		} else {
+			decoder := json.NewDecoder(body)
+			decoder.UseNumber()
+			err = decoder.Decode(&payload)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		item, message := mapIntake(&in.Mapping, payload, email)
+		if item == nil {
+			http.Error(w, message, 400)
+			return
+		}
+
+		labels, err := intakeLabels(&in, item.Labels)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		assigneeId, err := intakeAssignee(&in, item.Assignee)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		var itemId int64
+
+		if item.ExternalId != "" {
+			err := tx.QueryRow(newIntakeItemQuery, in.Id, item.ExternalId).Scan(&itemId)
+			if err == sql.ErrNoRows {
+				var taskId sql.NullInt64
+				err := tx.QueryRow(intakeItemTaskQuery, in.Id, item.ExternalId).Scan(&taskId)
+				if err != nil {
+					http.Error(w, err.Error(), 500)
+					return
+				}
+
+				result := IntakeResult{Duplicate: true}
+				if taskId.Valid {
+					result.TaskId = &taskId.Int64
+				}
+
+				json.NewEncoder(w).Encode(&result)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		nt := NewTask{Name: item.Title, Description: item.Description, CreatedBy: in.CreatedBy, ProjectId: in.ProjectId}
+
+		task, mentioned, err := insertTask(tx, &nt, in.CreatedBy)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		for _, l := range labels {
+			_, err := tx.Exec(intakeLabelQuery, task.Id, l.Id, in.CreatedBy)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		task.Labels = labels
+
+		if assigneeId != nil {
+			_, err := tx.Exec(intakeAssignQuery, *assigneeId, task.Id, in.CreatedBy)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			task.Assignees = append(task.Assignees, *assigneeId)
+		}
+
+		if item.ExternalId != "" {
+			_, err := tx.Exec(updateIntakeItemTaskQuery, itemId, task.Id)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		taskCreated(task, mentioned, in.CreatedBy)
+
+		if assigneeId != nil {
+			publishTaskEvent("task.assigned", task.Id, in.CreatedBy, &TaskAssignee{TaskId: task.Id, UserId: *assigneeId})
+			notifyUsers("assignment", task.Id, nil, in.CreatedBy, nil, []int64{*assigneeId})
+		}
+
+		log.Println("Intake " + strconv.FormatInt(in.Id, 10) + " created task " + strconv.FormatInt(task.Id, 10))
+
+		json.NewEncoder(w).Encode(&IntakeResult{TaskId: &task.Id})
+	}
+}
+
+func newIntakeHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_intake.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var in Intake
+
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "intake",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &in.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message, err = checkIntake(&in)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if in.Token == "" {
+			in.Token, err = randomToken()
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		if in.Active == nil {
+			active := true
+			in.Active = &active
+		}
+
+		mapping, _ := json.Marshal(in.Mapping)
+
+		err = stmt.QueryRow(in.ProjectId, in.Name, in.Token, string(mapping), *in.Active, auId).Scan(&in.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		in.CreatedBy = auId
+
+		json.NewEncoder(w).Encode(&in)
+	}
+}
+
+// updateIntakeHandler replaces an intake's name, mapping and active flag. An
+// empty token keeps the current one.
+func updateIntakeHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_intake.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var in Intake
+
+		err := json.NewDecoder(r.Body).Decode(&in)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getIntake(in.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Intake does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "intake",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		in.ProjectId = current.ProjectId
+		in.CreatedBy = current.CreatedBy
+
+		ok, message, err = checkIntake(&in)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if in.Token == "" {
+			in.Token = current.Token
+		}
+
+		if in.Active == nil {
+			in.Active = current.Active
+		}
+
+		mapping, _ := json.Marshal(in.Mapping)
+
+		_, dberr := stmt.Exec(in.Id, in.Name, in.Token, string(mapping), *in.Active)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&in)
+	}
+}
+
+func deleteIntakeHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_intake.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		in, err := getIntake(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Intake does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "intake",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &in.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(id)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+// getProjectIntakesHandler lists a project's intakes with their tokens, so
+// it is limited to the people who manage them.
+func getProjectIntakesHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_intakes.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		projectId, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "intake",
+			Action: "select",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		rows, err := db.Query(query, projectId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		intakes := make(Intakes, 0)
+
+		for rows.Next() {
+			in, err := scanIntake(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			intakes = append(intakes, in)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&intakes)
+	}
+}
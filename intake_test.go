@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMapIntake(t *testing.T) {
+	var payload map[string]interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(`{
+		"alert": {"name": "Disk  full\non db-1", "id": 12345678901, "labels": ["ops", " db "], "owner": "Jane Doe <jane@example.com>"},
+		"items": [{"text": "free space below 5%"}]
+	}`))
+	decoder.UseNumber()
+	decoder.Decode(&payload)
+
+	m := IntakeMapping{Title: "alert.name", Description: "items.0.text", Labels: "alert.labels", Assignee: "alert.owner", ExternalId: "alert.id"}
+
+	item, message := mapIntake(&m, payload, false)
+	if item == nil {
+		t.Fatalf("mapIntake failed: %s", message)
+	}
+
+	if item.Title != "Disk full on db-1" {
+		t.Errorf("title = %q", item.Title)
+	}
+
+	if item.Description != "free space below 5%" {
+		t.Errorf("description = %q", item.Description)
+	}
+
+	if strings.Join(item.Labels, ",") != "ops,db" {
+		t.Errorf("labels = %v", item.Labels)
+	}
+
+	if item.Assignee != "jane@example.com" {
+		t.Errorf("assignee = %q", item.Assignee)
+	}
+
+	if item.ExternalId != "12345678901" {
+		t.Errorf("external id = %q", item.ExternalId)
+	}
+
+	_, message = mapIntake(&IntakeMapping{}, payload, false)
+	if message == "" {
+		t.Error("payload without a title was accepted")
+	}
+}
+
+func TestEmailPayload(t *testing.T) {
+	email := "From: =?utf-8?q?J=C3=B6rg?= <jorg@example.com>\r\n" +
+		"To: intake@example.com\r\n" +
+		"Subject: Printer is on fire\r\n" +
+		"Message-ID: <abc@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=b1\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Third floor, sm=C3=B6ke everywhere.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Third floor</p>\r\n" +
+		"--b1--\r\n"
+
+	payload, err := emailPayload(strings.NewReader(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, message := mapIntake(&IntakeMapping{Assignee: "from"}, payload, true)
+	if item == nil {
+		t.Fatalf("mapIntake failed: %s", message)
+	}
+
+	if item.Title != "Printer is on fire" || item.ExternalId != "abc@example.com" || item.Assignee != "jorg@example.com" {
+		t.Errorf("mapped %+v", item)
+	}
+
+	if item.Description != "Third floor, smöke everywhere." {
+		t.Errorf("description = %q", item.Description)
+	}
+
+	if payload["from"] != "Jörg <jorg@example.com>" {
+		t.Errorf("from = %q", payload["from"])
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if s := truncate("héllo", 2); s != "h" {
+		t.Errorf("truncate split a character: %q", s)
+	}
+
+	if s := truncate("hello", 10); s != "hello" {
+		t.Errorf("truncate = %q", s)
+	}
+}
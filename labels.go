@@ -0,0 +1,417 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"regexp"
+	"strconv"
+)
+
+type Label struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Color string `json:"color"`
+}
+
+type Labels []Label
+
+type TaskLabel struct {
+	TaskId int64 `json:"task-id"`
+	LabelId int64 `json:"label-id"`
+}
+
+var labelColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func validLabel(l *Label) (bool, string) {
+	if l.Name == "" {
+		return false, "Label name can not be empty"
+	}
+
+	if !labelColor.MatchString(l.Color) {
+		return false, "Label color must be a hex color like #d73a4a"
+	}
+
+	return true, ""
+}
+
+var labelProjectQuery *sql.Stmt = prepareQuery("sql/get_label_project.sql")
+
+var taskProjectQuery *sql.Stmt = prepareQuery("sql/get_task_project.sql")
+
+var projectTaskLabelsQuery *sql.Stmt = prepareQuery("sql/get_project_task_labels.sql")
+
+// projectTaskLabels returns the labels of every task in a project keyed by task id.
+func projectTaskLabels(projectId int64) (map[int64]Labels, error) {
+	rows, err := projectTaskLabelsQuery.Query(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	taskLabels := make(map[int64]Labels)
+
+	for rows.Next() {
+		var taskId int64
+		label := Label{}
+
+		err := rows.Scan(&taskId, &label.Id, &label.ProjectId, &label.Name, &label.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		taskLabels[taskId] = append(taskLabels[taskId], label)
+	}
+
+	return taskLabels, rows.Err()
+}
+
+func newLabelHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_label.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var l Label
+
+		err := json.NewDecoder(r.Body).Decode(&l)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "label",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &l.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validLabel(&l)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		err = stmt.QueryRow(l.ProjectId, l.Name, l.Color).Scan(&l.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&l)
+	}
+}
+
+func updateLabelHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_label.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var l Label
+
+		err := json.NewDecoder(r.Body).Decode(&l)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		err = labelProjectQuery.QueryRow(l.Id).Scan(&l.ProjectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Label does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "label",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &l.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validLabel(&l)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(l.Id, l.Name, l.Color)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&l)
+	}
+}
+
+func deleteLabelHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_label.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		labelId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		var projectId int64
+		err := labelProjectQuery.QueryRow(labelId).Scan(&projectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Label does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "label",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(labelId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getProjectLabelsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_labels.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		labels := make(Labels, 0)
+
+		for rows.Next() {
+			label := Label{}
+
+			err := rows.Scan(&label.Id, &label.ProjectId, &label.Name, &label.Color)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			labels = append(labels, label)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&labels)
+	}
+}
+
+// taskLabelHandler is shared by adding and removing a label on a task,
+// both of which require the task and label to belong to the same project.
+// Field names the change in the published event.
+func taskLabelHandler(path string, field string) func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery(path)
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var tl TaskLabel
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&tl)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		var taskProjectId, labelProjectId int64
+
+		err := taskProjectQuery.QueryRow(tl.TaskId).Scan(&taskProjectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = labelProjectQuery.QueryRow(tl.LabelId).Scan(&labelProjectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Label does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if taskProjectId != labelProjectId {
+			http.Error(w, "Label does not belong to the task's project", 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &taskProjectId,
+			TaskId: &tl.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(tl.TaskId, tl.LabelId, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", tl.TaskId, auId, &Change{field, tl.LabelId})
+	}
+}
+
+func addTaskLabelHandler() func(http.ResponseWriter, *http.Request) {
+	return taskLabelHandler("sql/new_task_label.sql", "label-added")
+}
+
+func removeTaskLabelHandler() func(http.ResponseWriter, *http.Request) {
+	return taskLabelHandler("sql/delete_task_label.sql", "label-removed")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidLabel(t *testing.T) {
+	ok, _ := validLabel(&Label{Name: "bug", Color: "#d73a4a"})
+	if !ok {
+		t.Fatal("bug label with hex color should be valid")
+	}
+
+	ok, _ = validLabel(&Label{Name: "", Color: "#d73a4a"})
+	if ok {
+		t.Fatal("Label without a name should be invalid")
+	}
+
+	ok, _ = validLabel(&Label{Name: "chore", Color: "red"})
+	if ok {
+		t.Fatal("Label with a non hex color should be invalid")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+)
+
+// TaskLink is a link as seen from TaskId, so a task blocked by another
+// task lists the link with the blocked-by kind.
+type TaskLink struct {
+	Id int64 `json:"id"`
+	TaskId int64 `json:"task-id"`
+	OtherTaskId int64 `json:"other-task-id"`
+	OtherTaskName string `json:"other-task-name"`
+	OtherTaskStatus string `json:"other-task-status"`
+	Kind string `json:"kind"`
+}
+
+type TaskLinks []TaskLink
+
+type NewTaskLink struct {
+	TaskId int64 `json:"task-id"`
+	OtherTaskId int64 `json:"other-task-id"`
+	Kind string `json:"kind"`
+}
+
+// normalizeLink turns a link requested from either side into the stored
+// direction. Blocked-by and duplicated-by are stored as their inverse and
+// relates, being symmetric, is stored with the lower task id first.
+func normalizeLink(taskId, otherTaskId int64, kind string) (int64, int64, string, bool) {
+	switch kind {
+	case "blocks", "duplicates":
+		return taskId, otherTaskId, kind, true
+	case "blocked-by":
+		return otherTaskId, taskId, "blocks", true
+	case "duplicated-by":
+		return otherTaskId, taskId, "duplicates", true
+	case "relates":
+		if otherTaskId < taskId {
+			return otherTaskId, taskId, kind, true
+		}
+		return taskId, otherTaskId, kind, true
+	}
+
+	return 0, 0, "", false
+}
+
+// linkKindFor names a stored link from the point of view of one of its tasks.
+func linkKindFor(kind string, outgoing bool) (string) {
+	if outgoing {
+		return kind
+	}
+
+	switch kind {
+	case "blocks":
+		return "blocked-by"
+	case "duplicates":
+		return "duplicated-by"
+	}
+
+	return kind
+}
+
+var checkBlockingPathQuery string = loadQuery("sql/check_blocking_path.sql")
+
+// lockBlockingLinksQuery serializes adding blocking links until the end of
+// the transaction, so two links that close a cycle together can not both
+// pass the cycle check. Blocking links may join tasks of different
+// projects, so the lock is not per project.
+var lockBlockingLinksQuery string = loadQuery("sql/lock_blocking_links.sql")
+
+var getTaskLinkQuery *sql.Stmt = prepareQuery("sql/get_task_link.sql")
+
+func newTaskLinkHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_task_link.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var nl NewTaskLink
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&nl)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &nl.TaskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if nl.TaskId == nl.OtherTaskId {
+			http.Error(w, "A task can not be linked to itself", 400)
+			return
+		}
+
+		source, target, kind, ok := normalizeLink(nl.TaskId, nl.OtherTaskId, nl.Kind)
+		if !ok {
+			http.Error(w, "Link kind must be one of blocks, blocked-by, relates, duplicates or duplicated-by", 400)
+			return
+		}
+
+		var otherProjectId int64
+		err := taskProjectQuery.QueryRow(nl.OtherTaskId).Scan(&otherProjectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Linked task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		// A link changes both tasks, a blocking one can stop the other task
+		// from starting, so the user has to be able to update both.
+		otherRequest := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &otherProjectId,
+			TaskId: &nl.OtherTaskId,
+		}
+
+		if !otherRequest.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		if kind == "blocks" {
+			_, err := tx.Exec(lockBlockingLinksQuery)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			// Adding source blocks target closes a cycle when target already blocks source.
+			var cycle bool
+			err = tx.QueryRow(checkBlockingPathQuery, target, source).Scan(&cycle)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if cycle {
+				http.Error(w, "Link would create a blocking cycle", 409)
+				return
+			}
+		}
+
+		var id int64
+		err = tx.QueryRow(query, source, target, kind, auId).Scan(&id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&TaskLink{
+			Id: id,
+			TaskId: nl.TaskId,
+			OtherTaskId: nl.OtherTaskId,
+			Kind: linkKindFor(kind, source == nl.TaskId),
+		})
+	}
+}
+
+func deleteTaskLinkHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_task_link.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		linkId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		var id, source, target int64
+		var kind string
+		err := getTaskLinkQuery.QueryRow(linkId).Scan(&id, &source, &target, &kind)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task link does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		// Either side of the link may remove it.
+		sourceRequest := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &source,
+		}
+
+		targetRequest := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &target,
+		}
+
+		if !sourceRequest.Satisfied() && !targetRequest.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(linkId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getTaskLinksHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_task_links.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		taskId, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, taskId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		links := make(TaskLinks, 0)
+
+		for rows.Next() {
+			var source, target int64
+			var kind string
+			link := TaskLink{TaskId: taskId}
+
+			err := rows.Scan(&link.Id, &source, &target, &kind, &link.OtherTaskName, &link.OtherTaskStatus)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			outgoing := source == taskId
+			if outgoing {
+				link.OtherTaskId = target
+			} else {
+				link.OtherTaskId = source
+			}
+
+			link.Kind = linkKindFor(kind, outgoing)
+
+			links = append(links, link)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&links)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeLink(t *testing.T) {
+	source, target, kind, ok := normalizeLink(1, 2, "blocked-by")
+	if !ok || source != 2 || target != 1 || kind != "blocks" {
+		t.Fatal("1 blocked-by 2 should be stored as 2 blocks 1, got", source, target, kind)
+	}
+
+	source, target, kind, ok = normalizeLink(5, 3, "relates")
+	if !ok || source != 3 || target != 5 || kind != "relates" {
+		t.Fatal("relates should be stored with the lower id first, got", source, target, kind)
+	}
+
+	_, _, _, ok = normalizeLink(1, 2, "follows")
+	if ok {
+		t.Fatal("Unknown link kinds should be rejected")
+	}
+}
+
+func TestLinkKindFor(t *testing.T) {
+	if linkKindFor("blocks", true) != "blocks" {
+		t.Fatal("The source of a blocks link should see blocks")
+	}
+
+	if linkKindFor("blocks", false) != "blocked-by" {
+		t.Fatal("The target of a blocks link should see blocked-by")
+	}
+
+	if linkKindFor("duplicates", false) != "duplicated-by" {
+		t.Fatal("The target of a duplicates link should see duplicated-by")
+	}
+
+	if linkKindFor("relates", false) != "relates" {
+		t.Fatal("relates should read the same from both sides")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mail is a plain text email. Headers are added to the standard ones, such
+// as List-Unsubscribe.
+type Mail struct {
+	To string
+	Subject string
+	Body string
+	Headers map[string]string
+}
+
+// Mailer delivers emails.
+type Mailer interface {
+	Send(m *Mail) error
+}
+
+// message renders a mail as an RFC 5322 message from the given sender.
+func (m *Mail) message(from string, now time.Time) ([]byte) {
+	var b bytes.Buffer
+
+	headers := map[string]string{
+		"From": from,
+		"To": m.To,
+		"Subject": mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date": now.Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+		"Content-Type": "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "8bit",
+	}
+
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b.WriteString(k + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(headers[k]) + "\r\n")
+	}
+
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(strings.Replace(m.Body, "\r\n", "\n", -1), "\n", "\r\n", -1))
+
+	return b.Bytes()
+}
+
+type SMTPMailer struct {
+	Addr string
+	Host string
+	Username string
+	Password string
+	From string
+}
+
+func (s *SMTPMailer) Send(m *Mail) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, m.message(s.From, time.Now()))
+}
+
+// SpoolMailer writes every email to its own .eml file in Dir instead of
+// sending it, for development and tests.
+type SpoolMailer struct {
+	Dir string
+	From string
+}
+
+func (s *SpoolMailer) Send(m *Mail) error {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := strconv.FormatInt(now.UnixNano(), 10) + "-" + token + ".eml"
+
+	return ioutil.WriteFile(filepath.Join(s.Dir, name), m.message(s.From, now), 0644)
+}
+
+// NoMailer drops every email, for servers without mail set up.
+type NoMailer struct{}
+
+func (n *NoMailer) Send(m *Mail) error {
+	return nil
+}
+
+func newMailer(c MailConfig) (Mailer) {
+	switch c.Mailer {
+	case "none", "":
+		return &NoMailer{}
+	case "spool":
+		return &SpoolMailer{Dir: c.SpoolDir, From: c.From}
+	case "smtp":
+		return &SMTPMailer{
+			Addr: c.SMTP.Host + ":" + strconv.Itoa(c.SMTP.Port),
+			Host: c.SMTP.Host,
+			Username: c.SMTP.Username,
+			Password: c.SMTP.Password,
+			From: c.From,
+		}
+	}
+
+	log.Fatal("Unknown mailer: " + c.Mailer)
+	return nil
+}
+
+var mailer Mailer = newMailer(config.Mail)
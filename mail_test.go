@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"github.com/robfig/cron"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func TestSpoolMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kanelm-mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &SpoolMailer{Dir: dir, From: "kanelm@example.com"}
+
+	err = m.Send(&Mail{
+		To: "ricky@example.com",
+		Subject: "Hello\r\nBcc: someone@example.com",
+		Body: "line one\nline two\n",
+		Headers: map[string]string{"List-Unsubscribe": "<http://example.com/unsubscribe>"},
+	})
+	if err != nil {
+		t.Fatal("Send failed with", err.Error())
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatal("One message should be spooled, found", len(files))
+	}
+
+	b, _ := ioutil.ReadFile(files[0])
+	msg := string(b)
+
+	for _, want := range []string{"From: kanelm@example.com\r\n", "To: ricky@example.com\r\n", "List-Unsubscribe: <http://example.com/unsubscribe>\r\n", "\r\n\r\nline one\r\nline two\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Fatal("Message should contain", want, "got", msg)
+		}
+	}
+
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Fatal("A subject must not be able to add headers")
+	}
+}
+
+func TestDigestMail(t *testing.T) {
+	now := time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)
+
+	tasks := []DigestTask{
+		DigestTask{Id: 1, Name: "Late", Status: "Todo", DueAt: now.Add(-24 * time.Hour), ProjectId: 1, ProjectName: "galaxy"},
+		DigestTask{Id: 2, Name: "Soon", Status: "OnGoing", DueAt: now.Add(5 * time.Hour), ProjectId: 1, ProjectName: "galaxy"},
+	}
+
+	m := digestMail("ricky@example.com", "tok", 1, "ricky", tasks, now)
+
+	overdue := strings.Index(m.Body, "Overdue:\n- Late")
+	today := strings.Index(m.Body, "Due today:\n- Soon")
+
+	if overdue < 0 || today < overdue {
+		t.Fatal("Overdue tasks should be listed before the ones due today, got", m.Body)
+	}
+
+	if !strings.Contains(m.Headers["List-Unsubscribe"], "kind=digest") || !strings.Contains(m.Body, "token=tok") {
+		t.Fatal("The digest should link to unsubscribing from digests")
+	}
+}
+
+func TestDigestSchedule(t *testing.T) {
+	schedule, err := cron.Parse(defaultConfig().Mail.DigestSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 10, 19, 0, 6, 0, 0, time.Local)
+	want := time.Date(2026, 10, 19, 7, 0, 0, 0, time.Local)
+
+	if next := schedule.Next(now); !next.Equal(want) {
+		t.Errorf("digest after %s runs at %s, want %s", now, next, want)
+	}
+
+	if next := schedule.Next(want); !next.Equal(want.AddDate(0, 0, 1)) {
+		t.Errorf("digest after %s runs at %s, want the next day at 07:00", want, next)
+	}
+}
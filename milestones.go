@@ -0,0 +1,532 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Milestones group tasks from any project under a shared target date.
+type Milestone struct {
+	Id int64 `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	TargetDate string `json:"target-date"`
+	CreatedBy *int64 `json:"created-by"`
+	Progress MilestoneProgress `json:"progress"`
+}
+
+type Milestones []Milestone
+
+type MilestoneProgress struct {
+	Done int64 `json:"done"`
+	Total int64 `json:"total"`
+	PointsDone int64 `json:"points-done"`
+	PointsTotal int64 `json:"points-total"`
+}
+
+type MilestoneTask struct {
+	Id int64 `json:"id"`
+	Name string `json:"name"`
+	Status string `json:"status"`
+	Points int64 `json:"points"`
+	ProjectId int64 `json:"project-id"`
+	ProjectName string `json:"project-name"`
+}
+
+type MilestoneTasks []MilestoneTask
+
+type TaskMilestone struct {
+	Id int64 `json:"id"`
+	MilestoneId *int64 `json:"milestone-id"`
+}
+
+type TaskPoints struct {
+	Id int64 `json:"id"`
+	Points int64 `json:"points"`
+}
+
+func validMilestone(m *Milestone) (bool, string) {
+	if strings.TrimSpace(m.Name) == "" {
+		return false, "Milestone name can not be empty"
+	}
+
+	_, err := time.Parse(dateLayout, m.TargetDate)
+	if err != nil {
+		return false, "target-date must be a date like 2006-01-02"
+	}
+
+	return true, ""
+}
+
+var milestoneOwnerQuery *sql.Stmt = prepareQuery("sql/get_milestone_owner.sql")
+
+// milestoneOwner returns the creator of a milestone, or nil once the
+// creator has been deleted.
+func milestoneOwner(id int64) (*int64, error) {
+	var owner sql.NullInt64
+	err := milestoneOwnerQuery.QueryRow(id).Scan(&owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if !owner.Valid {
+		return nil, nil
+	}
+
+	return &owner.Int64, nil
+}
+
+func newMilestoneHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_milestone.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "milestone",
+			Action: "insert",
+			ActiveUserId: auId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var m Milestone
+
+		err := json.NewDecoder(r.Body).Decode(&m)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		ok, message = validMilestone(&m)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		m.CreatedBy = &auId
+		m.Progress = MilestoneProgress{}
+
+		err = stmt.QueryRow(m.Name, m.Description, m.TargetDate, auId).Scan(&m.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&m)
+	}
+}
+
+func updateMilestoneHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_milestone.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var m Milestone
+
+		err := json.NewDecoder(r.Body).Decode(&m)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		owner, err := milestoneOwner(m.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Milestone does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "milestone",
+			Action: "update",
+			ActiveUserId: auId,
+			UserId: owner,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validMilestone(&m)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(m.Id, m.Name, m.Description, m.TargetDate)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func deleteMilestoneHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_milestone.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		milestoneId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		owner, err := milestoneOwner(milestoneId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Milestone does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "milestone",
+			Action: "delete",
+			ActiveUserId: auId,
+			UserId: owner,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(milestoneId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+// getMilestonesHandler lists every milestone with its progress, or only
+// the milestone given by the optional id param.
+func getMilestonesHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_milestones.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		var id sql.NullInt64
+
+		if q["id"] != nil {
+			v, err := strconv.ParseInt(q["id"][0], 10, 64)
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+
+			id = sql.NullInt64{Int64: v, Valid: true}
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		milestones := make(Milestones, 0)
+
+		for rows.Next() {
+			m := Milestone{}
+			var target time.Time
+			var createdBy sql.NullInt64
+			p := &m.Progress
+
+			err := rows.Scan(&m.Id, &m.Name, &m.Description, &target, &createdBy, &p.Done, &p.Total, &p.PointsDone, &p.PointsTotal)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			m.TargetDate = target.Format(dateLayout)
+
+			if createdBy.Valid {
+				owner := createdBy.Int64
+				m.CreatedBy = &owner
+			}
+
+			milestones = append(milestones, m)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&milestones)
+	}
+}
+
+func getMilestoneTasksHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_milestone_tasks.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["milestoneid"] == nil {
+			http.Error(w, "milestoneid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["milestoneid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		tasks := make(MilestoneTasks, 0)
+
+		for rows.Next() {
+			t := MilestoneTask{}
+
+			err := rows.Scan(&t.Id, &t.Name, &t.Status, &t.Points, &t.ProjectId, &t.ProjectName)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			tasks = append(tasks, t)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&tasks)
+	}
+}
+
+var checkMilestoneExistsQuery *sql.Stmt = prepareQuery("sql/check_milestone_exists.sql")
+
+func updateTaskMilestoneHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_milestone.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var tm TaskMilestone
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&tm)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &tm.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if tm.MilestoneId != nil {
+			var exists bool
+			err := checkMilestoneExistsQuery.QueryRow(*tm.MilestoneId).Scan(&exists)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if !exists {
+				http.Error(w, "Milestone does not exist", 404)
+				return
+			}
+		}
+
+		_, dberr := stmt.Exec(tm.Id, tm.MilestoneId, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", tm.Id, auId, &Change{"milestone-id", tm.MilestoneId})
+	}
+}
+
+func updateTaskPointsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_points.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var tp TaskPoints
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&tp)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &tp.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if tp.Points < 0 {
+			http.Error(w, "Task points can not be negative", 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(tp.Id, tp.Points, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", tp.Id, auId, &Change{"points", tp.Points})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"encoding/json"
+	"net/http/httptest"
+	"io/ioutil"
+	"strconv"
+)
+
+func TestValidMilestone(t *testing.T) {
+	m := &Milestone{Name: "1.0", TargetDate: "2026-12-01"}
+	if ok, message := validMilestone(m); !ok {
+		t.Fatal(message)
+	}
+
+	m.TargetDate = "December"
+	if ok, _ := validMilestone(m); ok {
+		t.Fatal("A target date that is not a date should be rejected")
+	}
+
+	m.TargetDate = "2026-12-01"
+	m.Name = " "
+	if ok, _ := validMilestone(m); ok {
+		t.Fatal("An empty name should be rejected")
+	}
+}
+
+func getMilestone(t *testing.T, id int64) (*Milestone) {
+	server := httptest.NewServer(http.HandlerFunc(getMilestonesHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?id=" + strconv.FormatInt(id, 10))
+
+	if err != nil {
+		t.Fatal("Get milestones failed with", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		t.Fatal("Get milestones has error", string(body))
+	}
+
+	var milestones Milestones
+	err = json.NewDecoder(resp.Body).Decode(&milestones)
+	if err != nil {
+		t.Fatal("Decoding milestones failed", err.Error())
+	}
+
+	if len(milestones) != 1 {
+		t.Fatal("There should be one milestone, but there are", len(milestones))
+	}
+
+	return &milestones[0]
+}
+
+func addToMilestone(t *testing.T, task *Task, milestoneId int64, points int64) {
+	status, body := postHandler(t, updateTaskPointsHandler(), &TaskPoints{Id: task.Id, Points: points})
+	if status != 200 {
+		t.Fatal("Update task points has error", string(body))
+	}
+
+	status, body = postHandler(t, updateTaskMilestoneHandler(), &TaskMilestone{Id: task.Id, MilestoneId: &milestoneId})
+	if status != 200 {
+		t.Fatal("Update task milestone has error", string(body))
+	}
+}
+
+func TestIntegrationMilestoneProgress(t *testing.T) {
+	user := newUser(t)
+	project := newProject(t, user)
+	other := newProject(t, user)
+
+	status, body := postHandler(t, newMilestoneHandler(), &Milestone{Name: "1.0", TargetDate: "2026-12-01"})
+	if status != 200 {
+		t.Fatal("New milestone has error", string(body))
+	}
+
+	var milestone Milestone
+	err := json.Unmarshal(body, &milestone)
+	if err != nil {
+		t.Fatal("Decoding milestone failed: ", err.Error())
+	}
+
+	done := newTask(t, user, project)
+	addToMilestone(t, done, milestone.Id, 5)
+	addToMilestone(t, newTask(t, user, project), milestone.Id, 3)
+	addToMilestone(t, newTask(t, user, other), milestone.Id, 8)
+
+	if moveTaskTo(t, done, "Done") != 200 {
+		t.Fatal("Moving a task to Done failed")
+	}
+
+	progress := getMilestone(t, milestone.Id).Progress
+	if progress != (MilestoneProgress{Done: 1, Total: 3, PointsDone: 5, PointsTotal: 16}) {
+		t.Fatal("Progress should count tasks and points of both projects, got", progress)
+	}
+
+	deleteProject(t, other)
+
+	progress = getMilestone(t, milestone.Id).Progress
+	if progress != (MilestoneProgress{Done: 1, Total: 2, PointsDone: 5, PointsTotal: 8}) {
+		t.Fatal("Progress should leave out trashed projects, got", progress)
+	}
+}
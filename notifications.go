@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// Notification tells a user about something that happened to a task they
+// are assigned to or watch. Kind is assignment, status, comment, mention,
+// due-soon, overdue or escalation, which goes to project owners when a task
+// stays overdue. Data carries the old and new status of a status change and
+// the due date of the due date notifications, escalations also list the
+// assignees.
+type Notification struct {
+	Id int64 `json:"id"`
+	Kind string `json:"kind"`
+	TaskId int64 `json:"task-id"`
+	TaskName string `json:"task-name"`
+	CommentId *int64 `json:"comment-id"`
+	ActorId *int64 `json:"actor-id"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Read bool `json:"read"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type Notifications []Notification
+
+type NotificationPage struct {
+	Notifications Notifications `json:"notifications"`
+	Total int64 `json:"total"`
+	Unread int64 `json:"unread"`
+	Limit int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+var taskNotificationsQuery *sql.Stmt = prepareQuery("sql/new_task_notifications.sql")
+
+var userNotificationsQuery *sql.Stmt = prepareQuery("sql/new_user_notifications.sql")
+
+func notificationArgs(kind string, taskId int64, commentId *int64, actorId int64, data interface{}, userIds []int64) ([]interface{}) {
+	var dataJson interface{}
+	if data != nil {
+		b, _ := json.Marshal(data)
+		dataJson = string(b)
+	}
+
+	if userIds == nil {
+		userIds = make([]int64, 0)
+	}
+
+	usersJson, _ := json.Marshal(userIds)
+
+	return []interface{}{kind, taskId, commentId, actorId, dataJson, string(usersJson)}
+}
+
+// notifyWatchers notifies the assignees and watchers of a task, apart from
+// the user who acted and the users in except. Notifying follows a change
+// that is already saved, so a failure is logged rather than failing the
+// request.
+func notifyWatchers(kind string, taskId int64, commentId *int64, actorId int64, data interface{}, except []int64) {
+	_, err := taskNotificationsQuery.Exec(notificationArgs(kind, taskId, commentId, actorId, data, except)...)
+	if err != nil {
+		log.Println("Failed to notify watchers of task " + strconv.FormatInt(taskId, 10) + ": " + err.Error())
+	}
+}
+
+// notifyUsers notifies the given users, apart from the user who acted.
+func notifyUsers(kind string, taskId int64, commentId *int64, actorId int64, data interface{}, userIds []int64) {
+	if len(userIds) == 0 {
+		return
+	}
+
+	_, err := userNotificationsQuery.Exec(notificationArgs(kind, taskId, commentId, actorId, data, userIds)...)
+	if err != nil {
+		log.Println("Failed to notify users about task " + strconv.FormatInt(taskId, 10) + ": " + err.Error())
+	}
+}
+
+var dueSoonNotificationsQuery *sql.Stmt = prepareQuery("sql/new_due_soon_notifications.sql")
+
+var overdueNotificationsQuery *sql.Stmt = prepareQuery("sql/new_overdue_notifications.sql")
+
+var escalationNotificationsQuery *sql.Stmt = prepareQuery("sql/new_escalation_notifications.sql")
+
+// parseNotificationPeriod reads a due soon or escalation period, which must
+// be a positive Go duration.
+func parseNotificationPeriod(name string, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, errors.New("Invalid " + name + " period " + value)
+	}
+	return d, nil
+}
+
+func loadNotificationPeriod(name string, value string) (time.Duration) {
+	d, err := parseNotificationPeriod(name, value)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return d
+}
+
+var dueSoon time.Duration = loadNotificationPeriod("due soon", config.Notifications.DueSoon)
+
+var escalateAfter time.Duration = loadNotificationPeriod("escalation", config.Notifications.EscalateAfter)
+
+// notifyDueTasks notifies the assignees and watchers of open tasks that fall
+// due within the due soon period or are overdue, and the project owners of
+// tasks overdue for longer than the escalation period. Each kind is sent
+// once per due date, which the notifications table enforces, so restarts
+// and several servers running the job send no duplicates. Moving the due
+// date notifies again.
+func notifyDueTasks(now time.Time) {
+	_, err := dueSoonNotificationsQuery.Exec(now, now.Add(dueSoon))
+	if err != nil {
+		log.Println("Failed to notify due tasks: " + err.Error())
+	}
+
+	_, err = overdueNotificationsQuery.Exec(now)
+	if err != nil {
+		log.Println("Failed to notify overdue tasks: " + err.Error())
+	}
+
+	_, err = escalationNotificationsQuery.Exec(now.Add(-escalateAfter))
+	if err != nil {
+		log.Println("Failed to escalate overdue tasks: " + err.Error())
+	}
+}
+
+// dueDateNotifier schedules notifying about due and overdue tasks.
+func dueDateNotifier() {
+	err := scheduler.AddFunc(config.Notifications.Schedule, func() {
+		notifyDueTasks(time.Now())
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// getNotificationsHandler pages through the active user's notifications,
+// newest first. unread=true leaves out the ones already read.
+func getNotificationsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_notifications.sql")
+	countQuery := loadQuery("sql/count_notifications.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		unreadOnly := q.Get("unread") == "true"
+
+		limit, offset, err := pagination(q)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page := &NotificationPage{Limit: limit, Offset: offset}
+
+		err = db.QueryRow(countQuery, auId, unreadOnly).Scan(&page.Total, &page.Unread)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(query, auId, unreadOnly, limit, offset)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		page.Notifications = make(Notifications, 0)
+
+		for rows.Next() {
+			n := Notification{}
+			var commentId, actorId sql.NullInt64
+			var data []byte
+
+			err := rows.Scan(&n.Id, &n.Kind, &n.TaskId, &n.TaskName, &commentId, &actorId, &data, &n.Read, &n.CreatedAt)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if commentId.Valid {
+				id := commentId.Int64
+				n.CommentId = &id
+			}
+
+			if actorId.Valid {
+				id := actorId.Int64
+				n.ActorId = &id
+			}
+
+			if data != nil {
+				n.Data = json.RawMessage(data)
+			}
+
+			page.Notifications = append(page.Notifications, n)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+// getUnreadNotificationsHandler counts the active user's unread
+// notifications, cheap enough to poll for a badge.
+func getUnreadNotificationsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/count_notifications.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		var total, unread int64
+
+		err := db.QueryRow(query, auId, true).Scan(&total, &unread)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]int64{"unread": unread})
+	}
+}
+
+func readNotificationHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/read_notification.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		res, dberr := stmt.Exec(id, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			http.Error(w, "Notification does not exist", 404)
+			return
+		}
+	}
+}
+
+func readAllNotificationsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/read_all_notifications.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
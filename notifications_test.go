@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotificationArgs(t *testing.T) {
+	args := notificationArgs("comment", 3, nil, 1, nil, nil)
+
+	if args[4] != nil {
+		t.Fatal("Missing data should be sent as NULL, got", args[4])
+	}
+
+	if args[5] != "[]" {
+		t.Fatal("Missing users should be sent as an empty json array, got", args[5])
+	}
+
+	args = notificationArgs("status", 3, nil, 1, map[string]string{"new": "Done"}, []int64{2, 4})
+
+	if args[4] != `{"new":"Done"}` {
+		t.Fatal("Data should be sent as json, got", args[4])
+	}
+
+	if args[5] != "[2,4]" {
+		t.Fatal("Users should be sent as a json array, got", args[5])
+	}
+}
+
+func TestParseNotificationPeriod(t *testing.T) {
+	d, err := parseNotificationPeriod("escalation", "48h")
+	if err != nil || d != 48 * time.Hour {
+		t.Fatal("48h should parse, got", d, err)
+	}
+
+	for _, s := range []string{"", "0s", "-1h", "2d", "soon"} {
+		_, err := parseNotificationPeriod("escalation", s)
+		if err == nil {
+			t.Fatal(s, "should not parse")
+		}
+	}
+}
+
+func countDueNotifications(t *testing.T, task *Task, user *User, kind string) (int64) {
+	var n int64
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE task_id = $1 AND user_id = $2 AND kind = $3", task.Id, user.Id, kind).Scan(&n)
+	if err != nil {
+		t.Fatal("Counting notifications failed", err.Error())
+	}
+	return n
+}
+
+func TestIntegrationDueNotifications(t *testing.T) {
+	user := newUser(t)
+	project := newProject(t, user)
+	task := newTask(t, user, project)
+	assignTask(t, task, user)
+
+	due := time.Now().Add(-time.Hour).Truncate(time.Second)
+	status, body := postHandler(t, updateTaskDueHandler(), &Task{Id: task.Id, DueAt: &due})
+	if status != 200 {
+		t.Fatal("Update task due has error", string(body))
+	}
+
+	notifyDueTasks(due.Add(escalateAfter - time.Minute))
+
+	if countDueNotifications(t, task, user, "overdue") != 1 {
+		t.Fatal("The assignee should be notified once that the task is overdue")
+	}
+
+	if countDueNotifications(t, task, user, "escalation") != 0 {
+		t.Fatal("The task should not be escalated before the escalation period has passed")
+	}
+
+	notifyDueTasks(due.Add(escalateAfter + time.Minute))
+	notifyDueTasks(due.Add(escalateAfter + 2 * time.Minute))
+
+	// The user owns the project and is assigned to the task, so an escalation
+	// for the same user, task and due date has to be kept apart from the
+	// overdue notification.
+	if countDueNotifications(t, task, user, "escalation") != 1 {
+		t.Fatal("The project owner should be notified once that the task stayed overdue")
+	}
+
+	if countDueNotifications(t, task, user, "overdue") != 1 {
+		t.Fatal("The overdue notification should not be sent again")
+	}
+}
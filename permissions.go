@@ -20,7 +20,7 @@ func (s set) Add(str string) {
 }
 
 func (s set) Intersect(s2 set) (set) {
-	var newSet set
+	newSet := make(set)
 	for k := range s {
 		_, ok := s2[k]
 		if ok {
@@ -76,6 +76,7 @@ type RoleRequest struct {
 	UserId *int64	
 	ProjectId *int64
 	TaskId *int64
+	CommentId *int64
 }
 
 func prepareQuery(path string) (*sql.Stmt) {
@@ -93,6 +94,8 @@ var checkProjectOwnerQuery *sql.Stmt = prepareQuery("sql/check_project_owner.sql
 
 var checkTaskOwnerQuery *sql.Stmt = prepareQuery("sql/check_task_assignee.sql")
 
+var checkCommentAuthorQuery *sql.Stmt = prepareQuery("sql/check_comment_author.sql")
+
 func (r *RoleRequest) Satisfied() (bool) {
 
 	entity := permissions[r.Entity]
@@ -105,7 +108,8 @@ func (r *RoleRequest) Satisfied() (bool) {
 		log.Fatal("RoleRequest Action is unavailable")
 	}
 
-	var roles set
+	roles := make(set)
+	roles.Add("*")
 
 	var admin bool
 	err := checkAdminQuery.QueryRow(r.ActiveUserId).Scan(&admin)
@@ -114,6 +118,10 @@ func (r *RoleRequest) Satisfied() (bool) {
 		log.Fatal("Admin query failed")
 	}
 
+	if admin {
+		roles.Add("admin")
+	}
+
 	if r.UserId != nil {
 		if *r.UserId == r.ActiveUserId {
 			roles.Add("user owner")
@@ -140,7 +148,23 @@ func (r *RoleRequest) Satisfied() (bool) {
 		if err != nil {
 			log.Fatal("check task owner query failed")
 		}
-		roles.Add("task owner")
+
+		if taskOwner {
+			roles.Add("task owner")
+		}
+	}
+
+	if r.CommentId != nil {
+		var commentAuthor bool
+		err = checkCommentAuthorQuery.QueryRow(r.CommentId, r.ActiveUserId).Scan(&commentAuthor)
+
+		if err != nil {
+			log.Fatal("check comment author query failed")
+		}
+
+		if commentAuthor {
+			roles.Add("comment author")
+		}
 	}
 
 	permittedRoles := roles.Intersect(action)
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strings"
+)
+
+// ProjectClone asks for a copy of the project Id named Name. Settings,
+// labels, custom fields and saved boards are always copied. Tasks copies the
+// tasks with their subtasks, labels, custom values, checklists and links,
+// Assignees and Owners copy who works on them. Sprints and milestones are
+// bound to dates and are not copied.
+type ProjectClone struct {
+	Id int64 `json:"id"`
+	Name string `json:"name"`
+	Tasks bool `json:"tasks"`
+	Assignees bool `json:"assignees"`
+	Owners bool `json:"owners"`
+}
+
+// cloneStep is a query copying the rows tied to copied tasks.
+type cloneStep struct {
+	query string
+	args []interface{}
+}
+
+// idMap pairs the ids of copied rows with the ids of their copies.
+type idMap map[int64]int64
+
+// remapIds returns the copies of ids, dropping ids that were not copied.
+func remapIds(ids []int64, m idMap) ([]int64) {
+	remapped := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if n, ok := m[id]; ok {
+			remapped = append(remapped, n)
+		}
+	}
+	return remapped
+}
+
+// remapBoardFilter points a copied board filter at the copied labels and
+// custom fields. Filters on fields that were not copied are dropped.
+func remapBoardFilter(f BoardFilter, labels idMap, fields idMap) (BoardFilter) {
+	f.LabelIds = remapIds(f.LabelIds, labels)
+
+	remapped := make([]FieldFilter, 0, len(f.Fields))
+	for _, ff := range f.Fields {
+		if n, ok := fields[ff.FieldId]; ok {
+			ff.FieldId = n
+			remapped = append(remapped, ff)
+		}
+	}
+	f.Fields = remapped
+
+	if f.Sort != nil && f.Sort.FieldId != 0 {
+		sort := *f.Sort
+		n, ok := fields[sort.FieldId]
+		if ok {
+			sort.FieldId = n
+			f.Sort = &sort
+		} else {
+			f.Sort = nil
+		}
+	}
+
+	return f
+}
+
+var cloneSourceBoardsQuery string = loadQuery("sql/get_project_boards.sql")
+
+var cloneBoardQuery string = loadQuery("sql/new_board.sql")
+
+var cloneSourceTasksQuery string = loadQuery("sql/get_clone_source_tasks.sql")
+
+var cloneTaskQuery string = loadQuery("sql/clone_task.sql")
+
+var cloneProjectQuery string = loadQuery("sql/clone_project.sql")
+
+var cloneProjectOwnerQuery string = loadQuery("sql/new_project_owner.sql")
+
+var cloneProjectOwnersQuery string = loadQuery("sql/clone_project_owners.sql")
+
+var cloneLabelsQuery string = loadQuery("sql/clone_labels.sql")
+
+var cloneCustomFieldsQuery string = loadQuery("sql/clone_custom_fields.sql")
+
+var cloneTaskParentsQuery string = loadQuery("sql/clone_task_parents.sql")
+
+var cloneTaskLabelsQuery string = loadQuery("sql/clone_task_labels.sql")
+
+var cloneTaskCustomValuesQuery string = loadQuery("sql/clone_task_custom_values.sql")
+
+var cloneChecklistItemsQuery string = loadQuery("sql/clone_checklist_items.sql")
+
+var cloneTaskLinksQuery string = loadQuery("sql/clone_task_links.sql")
+
+var cloneTaskAssigneesQuery string = loadQuery("sql/clone_task_assignees.sql")
+
+func cloneIdMap(tx *sql.Tx, query string, sourceId int64, projectId int64) (idMap, error) {
+	rows, err := tx.Query(query, sourceId, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	m := make(idMap)
+
+	for rows.Next() {
+		var from, to int64
+
+		err := rows.Scan(&from, &to)
+		if err != nil {
+			return nil, err
+		}
+
+		m[from] = to
+	}
+
+	return m, rows.Err()
+}
+
+func cloneBoards(tx *sql.Tx, sourceId int64, projectId int64, createdBy int64, labels idMap, fields idMap) (error) {
+	rows, err := tx.Query(cloneSourceBoardsQuery, sourceId)
+	if err != nil {
+		return err
+	}
+
+	boards := make(SavedBoards, 0)
+
+	for rows.Next() {
+		b, err := scanSavedBoard(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		boards = append(boards, b)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range boards {
+		columns, _ := json.Marshal(b.Columns)
+		filter, _ := json.Marshal(remapBoardFilter(b.Filter, labels, fields))
+
+		var id int64
+		err := tx.QueryRow(cloneBoardQuery, projectId, b.Name, string(columns), string(filter), b.GroupBy, createdBy).Scan(&id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cloneTasks(tx *sql.Tx, sourceId int64, projectId int64, createdBy int64, pc *ProjectClone, labels idMap, fields idMap) (error) {
+	rows, err := tx.Query(cloneSourceTasksQuery, sourceId)
+	if err != nil {
+		return err
+	}
+
+	tasks := make(Tasks, 0)
+
+	for rows.Next() {
+		t := Task{}
+
+		err := rows.Scan(&t.Id, &t.Name, &t.Description, &t.Status, &t.Priority, &t.Points, &t.Archived)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	taskIds := make(idMap)
+
+	for _, t := range tasks {
+		var id int64
+		err := tx.QueryRow(cloneTaskQuery, t.Name, t.Description, t.Status, projectId, createdBy, t.Priority, t.Points, t.Archived).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		taskIds[t.Id] = id
+	}
+
+	tasksJson, _ := json.Marshal(taskIds)
+	labelsJson, _ := json.Marshal(labels)
+	fieldsJson, _ := json.Marshal(fields)
+
+	steps := []cloneStep{
+		{cloneTaskParentsQuery, []interface{}{string(tasksJson)}},
+		{cloneTaskLabelsQuery, []interface{}{string(tasksJson), string(labelsJson)}},
+		{cloneTaskCustomValuesQuery, []interface{}{string(tasksJson), string(fieldsJson)}},
+		{cloneChecklistItemsQuery, []interface{}{string(tasksJson)}},
+		{cloneTaskLinksQuery, []interface{}{string(tasksJson), createdBy}},
+	}
+
+	if pc.Assignees {
+		steps = append(steps, cloneStep{cloneTaskAssigneesQuery, []interface{}{string(tasksJson)}})
+	}
+
+	for _, step := range steps {
+		_, err := tx.Exec(step.query, step.args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cloneProject deep copies a project in a single transaction and returns the
+// copy, owned by createdBy. A template copy is kept out of the project list.
+func cloneProject(pc *ProjectClone, createdBy int64, template bool) (*Project, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	p := &Project{Name: pc.Name, CreatedBy: createdBy, Template: template}
+
+	err = tx.QueryRow(cloneProjectQuery, pc.Id, pc.Name, createdBy, template).Scan(&p.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(cloneProjectOwnerQuery, p.Id, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if pc.Owners {
+		_, err = tx.Exec(cloneProjectOwnersQuery, pc.Id, p.Id, createdBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	labels, err := cloneIdMap(tx, cloneLabelsQuery, pc.Id, p.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := cloneIdMap(tx, cloneCustomFieldsQuery, pc.Id, p.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cloneBoards(tx, pc.Id, p.Id, createdBy, labels, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if pc.Tasks {
+		err = cloneTasks(tx, pc.Id, p.Id, createdBy, pc, labels, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// cloneProjectHandler creates a project by copying another one. Cloning a
+// template is how a project is created from it. Saving a template copies the
+// project with template set, so later edits to either stay apart.
+func cloneProjectHandler(template bool) func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var pc ProjectClone
+
+		err := json.NewDecoder(r.Body).Decode(&pc)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "project",
+			Action: "insert",
+			ActiveUserId: auId,
+		}
+
+		// Owners may keep their project as a template, new projects need
+		// the right to create projects.
+		if template {
+			rr.Action = "update"
+			rr.ProjectId = &pc.Id
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if strings.TrimSpace(pc.Name) == "" {
+			http.Error(w, "Project name can not be empty", 400)
+			return
+		}
+
+		p, err := cloneProject(&pc, auId, template)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+func getProjectTemplatesHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_templates.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		rows, err := db.Query(query)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		templates := make(Projects, 0)
+
+		for rows.Next() {
+			p := Project{Template: true}
+
+			err := rows.Scan(&p.Id, &p.Name, &p.CreatedBy)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			templates = append(templates, p)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&templates)
+	}
+}
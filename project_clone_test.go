@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRemapBoardFilter(t *testing.T) {
+	labels := idMap{1: 11, 2: 12}
+	fields := idMap{5: 15}
+
+	f := BoardFilter{
+		LabelIds: []int64{1, 3},
+		AssigneeIds: []int64{7},
+		Fields: []FieldFilter{FieldFilter{FieldId: 5, Op: "set"}, FieldFilter{FieldId: 6, Op: "empty"}},
+		Sort: &TaskSort{FieldId: 5},
+	}
+
+	remapped := remapBoardFilter(f, labels, fields)
+
+	if len(remapped.LabelIds) != 1 || remapped.LabelIds[0] != 11 {
+		t.Fatal("Label 1 should become 11 and label 3 be dropped, got", remapped.LabelIds)
+	}
+
+	if len(remapped.AssigneeIds) != 1 || remapped.AssigneeIds[0] != 7 {
+		t.Fatal("Assignees should be kept")
+	}
+
+	if len(remapped.Fields) != 1 || remapped.Fields[0].FieldId != 15 {
+		t.Fatal("Field 5 should become 15 and field 6 be dropped, got", remapped.Fields)
+	}
+
+	if remapped.Sort == nil || remapped.Sort.FieldId != 15 || f.Sort.FieldId != 5 {
+		t.Fatal("Sort should move to field 15 without changing the source filter")
+	}
+
+	f.Sort = &TaskSort{FieldId: 6}
+	if remapBoardFilter(f, labels, fields).Sort != nil {
+		t.Fatal("Sorting by a field that was not copied should be dropped")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+)
+
+// ProjectSettings holds the per project switches for optional workflow rules.
+type ProjectSettings struct {
+	ProjectId int64 `json:"project-id"`
+	BlockParentDone bool `json:"block-parent-done"`
+	BlockBlockedStart bool `json:"block-blocked-start"`
+}
+
+var getProjectSettingsQuery *sql.Stmt = prepareQuery("sql/get_project_settings.sql")
+
+func getProjectSettings(projectId int64) (*ProjectSettings, error) {
+	ps := &ProjectSettings{}
+	err := getProjectSettingsQuery.QueryRow(projectId).Scan(&ps.ProjectId, &ps.BlockParentDone, &ps.BlockBlockedStart)
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+var lockTaskStatusQuery string = loadQuery("sql/lock_task_status.sql")
+
+var lockTaskParentQuery string = loadQuery("sql/lock_task_parent.sql")
+
+var lockBlockingLinksSharedQuery string = loadQuery("sql/lock_blocking_links_shared.sql")
+
+var countOpenSubtasksQuery string = loadQuery("sql/count_open_subtasks.sql")
+
+var checkTaskBlockedQuery string = loadQuery("sql/check_task_blocked.sql")
+
+// inProgressStatus is the board column work is started in.
+const inProgressStatus = "OnGoing"
+
+// workflowRefusal says why the enabled workflow rules refuse moving a task
+// with openSubtasks unfinished subtasks, blocked or not, to status. It is
+// empty when the move is allowed.
+func workflowRefusal(ps *ProjectSettings, status string, openSubtasks int64, blocked bool) (string) {
+	if status == "Done" && ps.BlockParentDone && openSubtasks > 0 {
+		return "Task has " + strconv.FormatInt(openSubtasks, 10) + " open subtasks"
+	}
+
+	if status == inProgressStatus && ps.BlockBlockedStart && blocked {
+		return "Task is blocked by unfinished tasks"
+	}
+
+	return ""
+}
+
+// statusChangeAllowed checks a task status change against the workflow
+// rules enabled for the task's project, returning the reason when it is
+// refused. It runs in the transaction that changes the status and locks the
+// task, its parent and the blocking links, so a subtask reopened or a
+// blocker linked at the same time can not slip past the rules. A task that
+// does not exist or is in the trash gives sql.ErrNoRows.
+func statusChangeAllowed(tx *sql.Tx, taskId int64, status string) (bool, string, error) {
+	var projectId int64
+	err := tx.QueryRow(lockTaskStatusQuery, taskId).Scan(&projectId)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Subtasks lock their parent while they change, so a parent moving to
+	// Done waits for them and counts what they commit.
+	_, err = tx.Exec(lockTaskParentQuery, taskId)
+	if err != nil {
+		return false, "", err
+	}
+
+	ps, err := getProjectSettings(projectId)
+	if err != nil {
+		return false, "", err
+	}
+
+	var open int64
+	var blocked bool
+
+	if status == "Done" && ps.BlockParentDone {
+		err := tx.QueryRow(countOpenSubtasksQuery, taskId).Scan(&open)
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	if status == inProgressStatus && ps.BlockBlockedStart {
+		_, err := tx.Exec(lockBlockingLinksSharedQuery)
+		if err != nil {
+			return false, "", err
+		}
+
+		err = tx.QueryRow(checkTaskBlockedQuery, taskId).Scan(&blocked)
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	message := workflowRefusal(ps, status, open, blocked)
+
+	return message == "", message, nil
+}
+
+func getProjectSettingsHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		ps, err := getProjectSettings(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(ps)
+	}
+}
+
+func updateProjectSettingsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_project_settings.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var ps ProjectSettings
+
+		err := json.NewDecoder(r.Body).Decode(&ps)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "project",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &ps.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(ps.ProjectId, ps.BlockParentDone, ps.BlockBlockedStart)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishProjectEvent("project.updated", ps.ProjectId, auId, &Change{"settings", &ps})
+	}
+}
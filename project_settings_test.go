@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWorkflowRefusal(t *testing.T) {
+	rules := &ProjectSettings{BlockParentDone: true, BlockBlockedStart: true}
+	none := &ProjectSettings{}
+
+	if message := workflowRefusal(rules, "Done", 2, false); message != "Task has 2 open subtasks" {
+		t.Errorf("a parent with open subtasks was moved to Done, got %q", message)
+	}
+
+	if message := workflowRefusal(rules, "Done", 0, true); message != "" {
+		t.Errorf("a parent with finished subtasks was refused: %s", message)
+	}
+
+	if message := workflowRefusal(none, "Done", 2, false); message != "" {
+		t.Errorf("the parent done rule applied while it is off: %s", message)
+	}
+
+	if message := workflowRefusal(rules, "OnGoing", 2, true); message != "Task is blocked by unfinished tasks" {
+		t.Errorf("a blocked task was started, got %q", message)
+	}
+
+	if message := workflowRefusal(none, "OnGoing", 0, true); message != "" {
+		t.Errorf("the blocked start rule applied while it is off: %s", message)
+	}
+
+	if message := workflowRefusal(rules, "Todo", 2, true); message != "" {
+		t.Errorf("moving back to Todo was refused: %s", message)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"github.com/lib/pq"
+	"log"
+	"fmt"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StreamEvent is what a project's event stream sends when one of its tasks
+// or the project itself changes. Type is task.created, task.moved,
+// task.renamed, task.updated, task.deleted, project.updated or
+// project.deleted. Moves carry the new status and renames the new name,
+// other changes only name the field, clients fetch what they show.
+type StreamEvent struct {
+	Type string `json:"event"`
+	ProjectId int64 `json:"project-id"`
+	TaskId *int64 `json:"task-id,omitempty"`
+	ActorId int64 `json:"actor-id"`
+	Field string `json:"field,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	At time.Time `json:"at"`
+}
+
+// streamChannel is the Postgres channel stream events are sent through, so
+// every server instance sees the changes made on the others.
+const streamChannel = "kanelm_events"
+
+// maxNotifyPayload keeps a stream event under the 8000 byte NOTIFY limit.
+const maxNotifyPayload = 7900
+
+// streamEvent turns a published event into what board clients need.
+func streamEvent(e *Event) (*StreamEvent) {
+	se := &StreamEvent{Type: e.Type, ProjectId: e.ProjectId, TaskId: e.TaskId, ActorId: e.ActorId, At: e.At}
+
+	switch e.Type {
+	case "task.created":
+		if t, ok := e.Data.(*Task); ok {
+			se.Field = "name"
+			se.Value = t.Name
+		}
+	case "task.assigned":
+		se.Type = "task.updated"
+		se.Field = "assignee"
+	case "task.updated", "project.updated":
+		c, ok := e.Data.(*Change)
+		if !ok {
+			break
+		}
+
+		se.Field = c.Field
+
+		switch c.Field {
+		case "status":
+			se.Type = "task.moved"
+			se.Value = c.Value
+		case "name":
+			if e.Type == "task.updated" {
+				se.Type = "task.renamed"
+			}
+			se.Value = c.Value
+		}
+	}
+
+	return se
+}
+
+// streamHub hands the stream events received from Postgres to the clients
+// subscribed to their project.
+type streamHub struct {
+	mu sync.Mutex
+	subscribers map[int64]map[chan []byte]struct{}
+}
+
+// streamBuffer is how many events a slow client may fall behind before it
+// is dropped. A dropped client reconnects and reloads the board.
+const streamBuffer = 64
+
+func newStreamHub() (*streamHub) {
+	return &streamHub{subscribers: make(map[int64]map[chan []byte]struct{})}
+}
+
+func (h *streamHub) subscribe(projectId int64) (chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := make(chan []byte, streamBuffer)
+
+	if h.subscribers[projectId] == nil {
+		h.subscribers[projectId] = make(map[chan []byte]struct{})
+	}
+
+	h.subscribers[projectId][c] = struct{}{}
+	return c
+}
+
+func (h *streamHub) unsubscribe(projectId int64, c chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(projectId, c)
+}
+
+func (h *streamHub) remove(projectId int64, c chan []byte) {
+	subs, ok := h.subscribers[projectId]
+	if !ok {
+		return
+	}
+
+	if _, ok := subs[c]; !ok {
+		return
+	}
+
+	delete(subs, c)
+	close(c)
+
+	if len(subs) == 0 {
+		delete(h.subscribers, projectId)
+	}
+}
+
+// broadcast sends a message to the subscribers of a project, or to every
+// subscriber when projectId is 0.
+func (h *streamHub) broadcast(projectId int64, msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, subs := range h.subscribers {
+		if projectId != 0 && id != projectId {
+			continue
+		}
+
+		for c := range subs {
+			select {
+			case c <- msg:
+			default:
+				h.remove(id, c)
+			}
+		}
+	}
+}
+
+var hub *streamHub = newStreamHub()
+
+var notifyStreamQuery *sql.Stmt = prepareQuery("sql/notify_stream.sql")
+
+// notifyStream sends a published event to every server instance.
+func notifyStream(e *Event) {
+	se := streamEvent(e)
+
+	payload, _ := json.Marshal(se)
+	if len(payload) > maxNotifyPayload {
+		se.Value = nil
+		payload, _ = json.Marshal(se)
+	}
+
+	_, err := notifyStreamQuery.Exec(streamChannel, string(payload))
+	if err != nil {
+		log.Println("Failed to notify " + e.Type + ": " + err.Error())
+	}
+}
+
+// resyncMessage tells clients they may have missed events and should reload,
+// sent when the connection to Postgres was lost.
+var resyncMessage = []byte(`{"event":"resync"}`)
+
+func dispatchNotification(n *pq.Notification) {
+	if n == nil {
+		hub.broadcast(0, resyncMessage)
+		return
+	}
+
+	var se StreamEvent
+
+	err := json.Unmarshal([]byte(n.Extra), &se)
+	if err != nil {
+		log.Println("Invalid stream event: " + err.Error())
+		return
+	}
+
+	hub.broadcast(se.ProjectId, []byte(n.Extra))
+}
+
+// realtimeListener publishes events to the stream channel and listens on it
+// for the events of every server instance.
+func realtimeListener() {
+	listener := pq.NewListener(connectionStr, 10 * time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Realtime listener: " + err.Error())
+		}
+	})
+
+	err := listener.Listen(streamChannel)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	listen(notifyStream)
+
+	go func() {
+		for {
+			select {
+			case n := <-listener.Notify:
+				dispatchNotification(n)
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+}
+
+// streamHeartbeat keeps proxies from closing an idle stream. The token is
+// checked again on every heartbeat, so a logged out client is disconnected.
+const streamHeartbeat = 25 * time.Second
+
+// getProjectStreamHandler streams the changes of a project as server sent
+// events, one event per change named after its type.
+func getProjectStreamHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		projectId, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		var deleted bool
+		err = projectTrashStateQuery.QueryRow(projectId).Scan(&deleted)
+		if err == sql.ErrNoRows || (err == nil && deleted) {
+			http.Error(w, "Project does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", 500)
+			return
+		}
+
+		events := hub.subscribe(projectId)
+		defer hub.unsubscribe(projectId, events)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case msg, open := <-events:
+				if !open {
+					return
+				}
+
+				var se StreamEvent
+				json.Unmarshal(msg, &se)
+
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", se.Type, msg)
+				flusher.Flush()
+			case <-heartbeat.C:
+				ok, _, _ := requestAuthorized(r)
+				if !ok {
+					return
+				}
+
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
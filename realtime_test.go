@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStreamEvent(t *testing.T) {
+	taskId := int64(7)
+
+	tests := []struct {
+		event Event
+		eventType string
+		field string
+		value interface{}
+	}{
+		{Event{Type: "task.created", Data: &Task{Name: "Write docs"}}, "task.created", "name", "Write docs"},
+		{Event{Type: "task.updated", Data: &Change{"status", "Done"}}, "task.moved", "status", "Done"},
+		{Event{Type: "task.updated", Data: &Change{"name", "Docs"}}, "task.renamed", "name", "Docs"},
+		{Event{Type: "task.updated", Data: &Change{"points", 3}}, "task.updated", "points", nil},
+		{Event{Type: "task.assigned", Data: int64(2)}, "task.updated", "assignee", nil},
+		{Event{Type: "project.updated", Data: &Change{"name", "Kanelm"}}, "project.updated", "name", "Kanelm"},
+		{Event{Type: "task.deleted"}, "task.deleted", "", nil},
+	}
+
+	for _, test := range tests {
+		test.event.ProjectId = 1
+		test.event.TaskId = &taskId
+
+		se := streamEvent(&test.event)
+		if se.Type != test.eventType || se.Field != test.field || se.Value != test.value {
+			t.Errorf("streamEvent(%s %v) = %s %s %v, want %s %s %v", test.event.Type, test.event.Data, se.Type, se.Field, se.Value, test.eventType, test.field, test.value)
+		}
+
+		if se.ProjectId != 1 || se.TaskId != &taskId {
+			t.Errorf("streamEvent(%s) lost its project or task", test.event.Type)
+		}
+	}
+}
+
+func TestStreamHub(t *testing.T) {
+	h := newStreamHub()
+
+	a := h.subscribe(1)
+	b := h.subscribe(2)
+
+	h.broadcast(1, []byte("one"))
+	h.broadcast(0, []byte("all"))
+
+	if msg := <-a; string(msg) != "one" {
+		t.Errorf("first message = %s, want one", msg)
+	}
+
+	if msg := <-a; string(msg) != "all" {
+		t.Errorf("second message = %s, want all", msg)
+	}
+
+	if msg := <-b; string(msg) != "all" {
+		t.Errorf("other project got %s, want all", msg)
+	}
+
+	for i := 0; i <= streamBuffer; i++ {
+		h.broadcast(2, []byte("slow"))
+	}
+
+	for range b {
+	}
+
+	if _, ok := h.subscribers[2]; ok {
+		t.Error("slow subscriber was not dropped")
+	}
+
+	h.unsubscribe(1, a)
+	h.unsubscribe(1, a)
+
+	if len(h.subscribers) != 0 {
+		t.Errorf("%d projects still subscribed", len(h.subscribers))
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"github.com/robfig/cron"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is the subset of RFC 5545 recurrence rules recurring tasks accept:
+// FREQ, INTERVAL, UNTIL, BYMONTH, BYMONTHDAY, BYDAY, BYHOUR and BYMINUTE.
+// Parts left out default to the start, so FREQ=MONTHLY repeats on the day
+// of the month and at the time of day the rule started.
+type RRule struct {
+	Freq string
+	Interval int
+	Until time.Time
+	ByMonth []int
+	ByMonthDay []int
+	ByDay []ruleDay
+	ByHour []int
+	ByMinute []int
+	Start time.Time
+}
+
+// ruleDay is a BYDAY entry. N picks the nth such weekday of the month,
+// counting from the end when negative, and is 0 for every such weekday.
+type ruleDay struct {
+	N int
+	Day time.Weekday
+}
+
+var ruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// maxRuleDays bounds the search for the next occurrence. Eight years covers
+// yearly rules on February 29.
+const maxRuleDays = 8 * 366
+
+func parseRuleInts(value string, min int, max int, allowNegative bool) ([]int, error) {
+	ints := make([]int, 0)
+
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, errors.New("Invalid number " + part)
+		}
+
+		if allowNegative && n < 0 {
+			n = -n
+			if n < min || n > max {
+				return nil, errors.New("Number " + part + " is out of range")
+			}
+			ints = append(ints, -n)
+			continue
+		}
+
+		if n < min || n > max {
+			return nil, errors.New("Number " + part + " is out of range")
+		}
+
+		ints = append(ints, n)
+	}
+
+	sort.Ints(ints)
+	return ints, nil
+}
+
+func parseRuleUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			if strings.HasSuffix(value, "Z") {
+				t, _ = time.Parse(layout, value)
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("UNTIL must look like 20060102 or 20060102T150405Z")
+}
+
+// parseRRule reads a rule such as FREQ=MONTHLY;BYDAY=-1FR;BYHOUR=9 with an
+// optional RRULE: prefix. Start anchors INTERVAL and the parts left out.
+func parseRRule(spec string, start time.Time) (*RRule, error) {
+	spec = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(spec)), "RRULE:")
+
+	r := &RRule{Interval: 1, Start: start}
+
+	for _, part := range strings.Split(spec, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, errors.New("Invalid rule part " + part)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "FREQ":
+			r.Freq = kv[1]
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(kv[1])
+			if err == nil && r.Interval < 1 {
+				err = errors.New("INTERVAL must be positive")
+			}
+		case "UNTIL":
+			r.Until, err = parseRuleUntil(kv[1])
+		case "BYMONTH":
+			r.ByMonth, err = parseRuleInts(kv[1], 1, 12, false)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseRuleInts(kv[1], 1, 31, true)
+		case "BYHOUR":
+			r.ByHour, err = parseRuleInts(kv[1], 0, 23, false)
+		case "BYMINUTE":
+			r.ByMinute, err = parseRuleInts(kv[1], 0, 59, false)
+		case "BYDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				if len(d) < 2 {
+					return nil, errors.New("Invalid BYDAY " + d)
+				}
+
+				day, ok := ruleWeekdays[d[len(d)-2:]]
+				if !ok {
+					return nil, errors.New("Invalid BYDAY " + d)
+				}
+
+				n := 0
+				if len(d) > 2 {
+					n, err = strconv.Atoi(d[:len(d)-2])
+					if err != nil || n == 0 || n < -5 || n > 5 {
+						return nil, errors.New("Invalid BYDAY " + d)
+					}
+				}
+
+				r.ByDay = append(r.ByDay, ruleDay{N: n, Day: day})
+			}
+		default:
+			return nil, errors.New("Rule part " + kv[0] + " is not supported")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch r.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, errors.New("A rule needs a FREQ")
+	default:
+		return nil, errors.New("FREQ must be one of DAILY, WEEKLY, MONTHLY or YEARLY")
+	}
+
+	if r.Freq == "DAILY" || r.Freq == "WEEKLY" {
+		for _, d := range r.ByDay {
+			if d.N != 0 {
+				return nil, errors.New("Numbered BYDAY can only be used with MONTHLY or YEARLY rules")
+			}
+		}
+	}
+
+	if r.ByHour == nil {
+		r.ByHour = []int{start.Hour()}
+	}
+
+	if r.ByMinute == nil {
+		r.ByMinute = []int{start.Minute()}
+	}
+
+	return r, nil
+}
+
+func ruleDate(t time.Time) (time.Time) {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func daysIn(year int, month time.Month, loc *time.Location) (int) {
+	return time.Date(year, month + 1, 0, 0, 0, 0, 0, loc).Day()
+}
+
+func hasInt(ints []int, n int) (bool) {
+	for _, i := range ints {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// inInterval reports whether day falls in a period counted from the start
+// that INTERVAL keeps. Weeks start on Monday.
+func (r *RRule) inInterval(day time.Time) (bool) {
+	start := ruleDate(r.Start)
+
+	switch r.Freq {
+	case "DAILY":
+		return int(day.Sub(start).Hours() / 24 + 0.5) % r.Interval == 0
+	case "WEEKLY":
+		monday := func(t time.Time) time.Time {
+			return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+		}
+		weeks := int(monday(day).Sub(monday(start)).Hours() / 24 + 0.5) / 7
+		return weeks % r.Interval == 0
+	case "MONTHLY":
+		months := (day.Year() - start.Year()) * 12 + int(day.Month()) - int(start.Month())
+		return months % r.Interval == 0
+	}
+
+	return (day.Year() - start.Year()) % r.Interval == 0
+}
+
+func (r *RRule) dayMatches(day time.Time) (bool) {
+	if !r.inInterval(day) {
+		return false
+	}
+
+	monthDays := daysIn(day.Year(), day.Month(), day.Location())
+
+	if r.ByMonth != nil && !hasInt(r.ByMonth, int(day.Month())) {
+		return false
+	}
+
+	if r.ByMonthDay != nil && !hasInt(r.ByMonthDay, day.Day()) && !hasInt(r.ByMonthDay, day.Day() - monthDays - 1) {
+		return false
+	}
+
+	if r.ByDay != nil {
+		matched := false
+
+		for _, d := range r.ByDay {
+			if d.Day != day.Weekday() {
+				continue
+			}
+
+			if d.N == 0 || (d.N > 0 && (day.Day() - 1) / 7 + 1 == d.N) || (d.N < 0 && (monthDays - day.Day()) / 7 + 1 == -d.N) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	// Parts left out repeat on the start's weekday, day of month or date.
+	switch r.Freq {
+	case "WEEKLY":
+		if r.ByDay == nil && r.ByMonthDay == nil {
+			return day.Weekday() == r.Start.Weekday()
+		}
+	case "MONTHLY":
+		if r.ByDay == nil && r.ByMonthDay == nil {
+			return day.Day() == r.Start.Day()
+		}
+	case "YEARLY":
+		if r.ByDay == nil && r.ByMonthDay == nil {
+			if r.ByMonth == nil && day.Month() != r.Start.Month() {
+				return false
+			}
+			return day.Day() == r.Start.Day()
+		}
+	}
+
+	return true
+}
+
+// Next returns the first occurrence after t, or the zero time once the rule
+// has ended.
+func (r *RRule) Next(t time.Time) (time.Time) {
+	t = t.In(r.Start.Location())
+	if t.Before(r.Start) {
+		t = r.Start.Add(-time.Second)
+	}
+
+	day := ruleDate(t)
+
+	for i := 0; i < maxRuleDays; i++ {
+		if r.dayMatches(day) {
+			for _, h := range r.ByHour {
+				for _, m := range r.ByMinute {
+					at := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+					if !at.After(t) {
+						continue
+					}
+
+					if !r.Until.IsZero() && at.After(r.Until) {
+						return time.Time{}
+					}
+
+					return at
+				}
+			}
+		}
+
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return time.Time{}
+}
+
+// startedSchedule keeps a cron schedule from firing before its start.
+type startedSchedule struct {
+	schedule cron.Schedule
+	start time.Time
+}
+
+func (s *startedSchedule) Next(t time.Time) (time.Time) {
+	if t.Before(s.start) {
+		t = s.start.Add(-time.Second)
+	}
+	return s.schedule.Next(t)
+}
+
+// parseRecurrence reads a recurring task schedule, either an RRULE or a
+// standard five field cron spec such as "0 9 1 * *".
+func parseRecurrence(spec string, start time.Time) (cron.Schedule, error) {
+	upper := strings.ToUpper(strings.TrimSpace(spec))
+
+	if strings.HasPrefix(upper, "RRULE:") || strings.HasPrefix(upper, "FREQ=") {
+		return parseRRule(spec, start)
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &startedSchedule{schedule: schedule, start: start}, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRRuleNext(t *testing.T) {
+	start := time.Date(2026, time.January, 15, 9, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		rule string
+		after time.Time
+		want time.Time
+	}{
+		{"FREQ=MONTHLY", start, time.Date(2026, time.February, 15, 9, 30, 0, 0, time.UTC)},
+		{"RRULE:FREQ=MONTHLY;BYMONTHDAY=1;BYHOUR=9;BYMINUTE=0", start, time.Date(2026, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", start, time.Date(2026, time.January, 31, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=MONTHLY;BYDAY=-1FR", start, time.Date(2026, time.January, 30, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=MONTHLY;BYDAY=1MO", start, time.Date(2026, time.February, 2, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", start, time.Date(2026, time.January, 26, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=DAILY;INTERVAL=3", start.Add(-time.Hour), start},
+		{"FREQ=DAILY;INTERVAL=3", start, time.Date(2026, time.January, 18, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=DAILY;BYHOUR=8,17;BYMINUTE=0", start, time.Date(2026, time.January, 15, 17, 0, 0, 0, time.UTC)},
+		{"FREQ=YEARLY", start, time.Date(2027, time.January, 15, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=1", start, time.Date(2026, time.March, 1, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=MONTHLY;UNTIL=20260301", start, time.Date(2026, time.February, 15, 9, 30, 0, 0, time.UTC)},
+		{"FREQ=MONTHLY;UNTIL=20260301", time.Date(2026, time.February, 15, 9, 30, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, c := range cases {
+		r, err := parseRRule(c.rule, start)
+		if err != nil {
+			t.Fatal(c.rule, err)
+		}
+
+		got := r.Next(c.after)
+		if !got.Equal(c.want) {
+			t.Fatal(c.rule, "after", c.after, "should be", c.want, "got", got)
+		}
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	rules := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=3",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	}
+
+	for _, rule := range rules {
+		_, err := parseRRule(rule, time.Now())
+		if err == nil {
+			t.Fatal(rule, "should not parse")
+		}
+	}
+}
+
+func TestValidRecurringTask(t *testing.T) {
+	rt := RecurringTask{Name: "Rotate certificates", Schedule: "FREQ=MONTHLY;BYMONTHDAY=1;BYHOUR=9;BYMINUTE=0"}
+
+	ok, message := validRecurringTask(&rt)
+	if !ok {
+		t.Fatal(message)
+	}
+
+	if rt.SkipIfOpen == nil || !*rt.SkipIfOpen || rt.Priority != "none" {
+		t.Fatal("Recurring tasks should skip while open and have no priority by default")
+	}
+
+	if rt.NextRunAt == nil || rt.NextRunAt.Day() != 1 || rt.NextRunAt.Hour() != 9 || !rt.NextRunAt.After(time.Now()) {
+		t.Fatal("Next run should be 9:00 on the next first of the month, got", rt.NextRunAt)
+	}
+
+	rt.Schedule = "FREQ=DAILY;UNTIL=20200101"
+	if ok, _ := validRecurringTask(&rt); ok {
+		t.Fatal("A schedule that already ended should be rejected")
+	}
+
+	rt.Schedule = "FREQ=FORTNIGHTLY"
+	if ok, _ := validRecurringTask(&rt); ok {
+		t.Fatal("An invalid schedule should be rejected")
+	}
+}
@@ -0,0 +1,732 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecurringTask is a template that creates a task in the first board column
+// at every occurrence of its schedule, a five field cron spec or an RRULE.
+// With SkipIfOpen, on by default, an occurrence is skipped while the task
+// created last time is still open.
+type RecurringTask struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Schedule string `json:"schedule"`
+	StartsAt time.Time `json:"starts-at"`
+	SkipIfOpen *bool `json:"skip-if-open"`
+	Priority string `json:"priority"`
+	Points int64 `json:"points"`
+	LabelIds []int64 `json:"label-ids"`
+	AssigneeIds []int64 `json:"assignee-ids"`
+	CustomFields CustomValues `json:"custom-fields"`
+	NextRunAt *time.Time `json:"next-run-at"`
+	LastRunAt *time.Time `json:"last-run-at"`
+	LastTaskId *int64 `json:"last-task-id"`
+	CreatedBy *int64 `json:"created-by"`
+}
+
+type RecurringTasks []RecurringTask
+
+// nextRun returns the first occurrence of a schedule after t, or nil once
+// the schedule has ended.
+func nextRun(schedule string, start time.Time, t time.Time) (*time.Time, error) {
+	s, err := parseRecurrence(schedule, start)
+	if err != nil {
+		return nil, err
+	}
+
+	next := s.Next(t)
+	if next.IsZero() {
+		return nil, nil
+	}
+
+	return &next, nil
+}
+
+func validRecurringTask(rt *RecurringTask) (bool, string) {
+	if strings.TrimSpace(rt.Name) == "" {
+		return false, "Recurring task name can not be empty"
+	}
+
+	if rt.Priority == "" {
+		rt.Priority = "none"
+	}
+
+	if !toSet(priorities).Has(rt.Priority) {
+		return false, "priority must be one of urgent, high, medium, low or none"
+	}
+
+	if rt.Points < 0 {
+		return false, "Task points can not be negative"
+	}
+
+	if rt.StartsAt.IsZero() {
+		rt.StartsAt = time.Now()
+	}
+
+	if rt.SkipIfOpen == nil {
+		skip := true
+		rt.SkipIfOpen = &skip
+	}
+
+	if rt.LabelIds == nil {
+		rt.LabelIds = make([]int64, 0)
+	}
+
+	if rt.AssigneeIds == nil {
+		rt.AssigneeIds = make([]int64, 0)
+	}
+
+	if rt.CustomFields == nil {
+		rt.CustomFields = make(CustomValues)
+	}
+
+	next, err := nextRun(rt.Schedule, rt.StartsAt, time.Now())
+	if err != nil {
+		return false, "Invalid schedule: " + err.Error()
+	}
+
+	if next == nil {
+		return false, "The schedule has no occurrence left"
+	}
+
+	rt.NextRunAt = next
+
+	return true, ""
+}
+
+// checkRecurringTask validates a template and checks its labels and custom
+// fields belong to its project and its assignees exist.
+func checkRecurringTask(rt *RecurringTask) (bool, string, error) {
+	ok, message := validRecurringTask(rt)
+	if !ok {
+		return false, message, nil
+	}
+
+	for _, labelId := range rt.LabelIds {
+		var projectId int64
+		err := labelProjectQuery.QueryRow(labelId).Scan(&projectId)
+		if err == sql.ErrNoRows || (err == nil && projectId != rt.ProjectId) {
+			return false, "Label " + strconv.FormatInt(labelId, 10) + " does not belong to the project", nil
+		}
+
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	for _, userId := range rt.AssigneeIds {
+		var exists bool
+		err := checkUserExistsQuery.QueryRow(userId).Scan(&exists)
+		if err != nil {
+			return false, "", err
+		}
+
+		if !exists {
+			return false, "User " + strconv.FormatInt(userId, 10) + " does not exist", nil
+		}
+	}
+
+	if len(rt.CustomFields) == 0 {
+		return true, "", nil
+	}
+
+	fields, err := projectCustomFields(rt.ProjectId)
+	if err != nil {
+		return false, "", err
+	}
+
+	byId := make(map[int64]CustomField)
+	for _, f := range fields {
+		byId[f.Id] = f
+	}
+
+	for fieldId, raw := range rt.CustomFields {
+		f, ok := byId[fieldId]
+		if !ok {
+			return false, "Custom field " + strconv.FormatInt(fieldId, 10) + " does not belong to the project", nil
+		}
+
+		value, err := normalizeCustomValue(&f, raw)
+		if err != nil {
+			return false, err.Error(), nil
+		}
+
+		rt.CustomFields[fieldId] = value
+	}
+
+	return true, "", nil
+}
+
+func scanRecurringTask(row rowScanner) (RecurringTask, error) {
+	rt := RecurringTask{}
+	var labelIds, assigneeIds, customFields []byte
+	var nextRunAt, lastRunAt sql.NullTime
+	var lastTaskId, createdBy sql.NullInt64
+	skip := true
+
+	err := row.Scan(&rt.Id, &rt.ProjectId, &rt.Name, &rt.Schedule, &rt.StartsAt, &skip, &rt.Priority, &rt.Points,
+		&labelIds, &assigneeIds, &customFields, &nextRunAt, &lastRunAt, &lastTaskId, &createdBy)
+	if err != nil {
+		return rt, err
+	}
+
+	rt.SkipIfOpen = &skip
+
+	if nextRunAt.Valid {
+		rt.NextRunAt = &nextRunAt.Time
+	}
+
+	if lastRunAt.Valid {
+		rt.LastRunAt = &lastRunAt.Time
+	}
+
+	if lastTaskId.Valid {
+		id := lastTaskId.Int64
+		rt.LastTaskId = &id
+	}
+
+	if createdBy.Valid {
+		id := createdBy.Int64
+		rt.CreatedBy = &id
+	}
+
+	err = json.Unmarshal(labelIds, &rt.LabelIds)
+	if err != nil {
+		return rt, err
+	}
+
+	err = json.Unmarshal(assigneeIds, &rt.AssigneeIds)
+	if err != nil {
+		return rt, err
+	}
+
+	err = json.Unmarshal(customFields, &rt.CustomFields)
+	return rt, err
+}
+
+var getRecurringTaskQuery *sql.Stmt = prepareQuery("sql/get_recurring_task.sql")
+
+func getRecurringTask(id int64) (*RecurringTask, error) {
+	rt, err := scanRecurringTask(getRecurringTaskQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// recurringTaskArgs lists the columns saved by the new and update queries
+// after the project or id.
+func recurringTaskArgs(rt *RecurringTask) ([]interface{}) {
+	labelIds, _ := json.Marshal(rt.LabelIds)
+	assigneeIds, _ := json.Marshal(rt.AssigneeIds)
+	customFields, _ := json.Marshal(rt.CustomFields)
+
+	return []interface{}{rt.Name, rt.Schedule, rt.StartsAt, *rt.SkipIfOpen, rt.Priority, rt.Points,
+		string(labelIds), string(assigneeIds), string(customFields), rt.NextRunAt}
+}
+
+func newRecurringTaskHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_recurring_task.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var rt RecurringTask
+
+		err := json.NewDecoder(r.Body).Decode(&rt)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "recurring",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &rt.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message, err = checkRecurringTask(&rt)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		args := append([]interface{}{rt.ProjectId}, recurringTaskArgs(&rt)...)
+
+		err = stmt.QueryRow(append(args, auId)...).Scan(&rt.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rt.CreatedBy = &auId
+		rt.LastRunAt = nil
+		rt.LastTaskId = nil
+
+		json.NewEncoder(w).Encode(&rt)
+	}
+}
+
+// updateRecurringTaskHandler replaces a template. Its next run is worked out
+// again from the new schedule.
+func updateRecurringTaskHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_recurring_task.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var rt RecurringTask
+
+		err := json.NewDecoder(r.Body).Decode(&rt)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getRecurringTask(rt.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Recurring task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "recurring",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		rt.ProjectId = current.ProjectId
+
+		ok, message, err = checkRecurringTask(&rt)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(append([]interface{}{rt.Id}, recurringTaskArgs(&rt)...)...)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		rt.LastRunAt = current.LastRunAt
+		rt.LastTaskId = current.LastTaskId
+		rt.CreatedBy = current.CreatedBy
+
+		json.NewEncoder(w).Encode(&rt)
+	}
+}
+
+func deleteRecurringTaskHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_recurring_task.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		id, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		rt, err := getRecurringTask(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Recurring task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "recurring",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &rt.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(id)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getProjectRecurringTasksHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_recurring_tasks.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		templates := make(RecurringTasks, 0)
+
+		for rows.Next() {
+			rt, err := scanRecurringTask(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			templates = append(templates, rt)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&templates)
+	}
+}
+
+var dueRecurringTasksQuery *sql.Stmt = prepareQuery("sql/get_due_recurring_tasks.sql")
+
+var lockRecurringTaskQuery string = loadQuery("sql/lock_recurring_task.sql")
+
+var checkTaskOpenQuery string = loadQuery("sql/check_task_open.sql")
+
+var newRecurringInstanceQuery string = loadQuery("sql/new_recurring_task_instance.sql")
+
+var finishRecurringRunQuery string = loadQuery("sql/finish_recurring_run.sql")
+
+var recurringAssigneeQuery string = loadQuery("sql/new_task_assignee.sql")
+
+var recurringLabelQuery string = loadQuery("sql/new_task_label.sql")
+
+var recurringValueQuery string = loadQuery("sql/set_task_custom_value.sql")
+
+var recurringLabelsQuery string = loadQuery("sql/get_task_labels.sql")
+
+// runRecurringTask creates the task for one due template and moves its next
+// run past now in the same transaction, so an occurrence is never created
+// twice however many servers run the job or how often they restart.
+func runRecurringTask(id int64, now time.Time) (error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	rt, err := scanRecurringTask(tx.QueryRow(lockRecurringTaskQuery, id, now))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	next, err := nextRun(rt.Schedule, rt.StartsAt, now)
+	if err != nil {
+		return err
+	}
+
+	open := false
+
+	if *rt.SkipIfOpen && rt.LastTaskId != nil {
+		err := tx.QueryRow(checkTaskOpenQuery, *rt.LastTaskId).Scan(&open)
+		if err != nil {
+			return err
+		}
+	}
+
+	var taskId *int64
+	var task *Task
+
+	if !open {
+		var newId, createdBy int64
+
+		err := tx.QueryRow(newRecurringInstanceQuery, rt.Id, boardColumns[0]).Scan(&newId, &createdBy)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range rt.AssigneeIds {
+			_, err := tx.Exec(recurringAssigneeQuery, userId, newId, createdBy)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, labelId := range rt.LabelIds {
+			_, err := tx.Exec(recurringLabelQuery, newId, labelId, createdBy)
+			if err != nil {
+				return err
+			}
+		}
+
+		for fieldId, value := range rt.CustomFields {
+			_, err := tx.Exec(recurringValueQuery, newId, fieldId, string(value), createdBy)
+			if err != nil {
+				return err
+			}
+		}
+
+		task, err = recurringInstance(tx, &rt, newId, createdBy)
+		if err != nil {
+			return err
+		}
+
+		taskId = &newId
+	}
+
+	_, err = tx.Exec(finishRecurringRunQuery, rt.Id, taskId, now, next)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if task != nil {
+		taskCreated(task, nil, task.CreatedBy)
+
+		for _, userId := range task.Assignees {
+			publishTaskEvent("task.assigned", task.Id, task.CreatedBy, &TaskAssignee{TaskId: task.Id, UserId: userId})
+		}
+
+		if len(task.Assignees) > 0 {
+			notifyUsers("assignment", task.Id, nil, task.CreatedBy, nil, task.Assignees)
+		}
+	}
+
+	return nil
+}
+
+// recurringInstance describes the task a run of rt created, for the events
+// and notifications sent once the run is committed.
+func recurringInstance(tx *sql.Tx, rt *RecurringTask, id int64, createdBy int64) (*Task, error) {
+	task := &Task{
+		Id: id,
+		Name: rt.Name,
+		Status: boardColumns[0],
+		ProjectId: rt.ProjectId,
+		CreatedBy: createdBy,
+		Priority: rt.Priority,
+		Points: rt.Points,
+		Labels: make(Labels, 0),
+		Assignees: append(make([]int64, 0), rt.AssigneeIds...),
+		CustomFields: make(CustomValues),
+	}
+
+	for fieldId, value := range rt.CustomFields {
+		task.CustomFields[fieldId] = value
+	}
+
+	rows, err := tx.Query(recurringLabelsQuery, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		label := Label{}
+
+		err := rows.Scan(&label.Id, &label.ProjectId, &label.Name, &label.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		task.Labels = append(task.Labels, label)
+	}
+
+	return task, rows.Err()
+}
+
+var skipRecurringRunQuery *sql.Stmt = prepareQuery("sql/finish_recurring_run.sql")
+
+// runRecurringTasks creates the tasks of every due template. A template that
+// fails, say because a preset label was deleted, still moves on to its next
+// run so it is not retried every minute.
+func runRecurringTasks(now time.Time) {
+	rows, err := dueRecurringTasksQuery.Query(now)
+	if err != nil {
+		log.Println("Failed to load recurring tasks: " + err.Error())
+		return
+	}
+
+	ids := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Println("Failed to load recurring tasks: " + err.Error())
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	for _, id := range ids {
+		err := runRecurringTask(id, now)
+		if err == nil {
+			continue
+		}
+
+		log.Println("Failed to create recurring task " + strconv.FormatInt(id, 10) + ": " + err.Error())
+
+		rt, err := getRecurringTask(id)
+		if err != nil {
+			log.Println("Failed to skip recurring task " + strconv.FormatInt(id, 10) + ": " + err.Error())
+			continue
+		}
+
+		// A schedule that can not be read has no next run and stops here.
+		next, err := nextRun(rt.Schedule, rt.StartsAt, now)
+		if err != nil {
+			log.Println("Failed to schedule recurring task " + strconv.FormatInt(id, 10) + ": " + err.Error())
+		}
+
+		_, err = skipRecurringRunQuery.Exec(id, nil, now, next)
+		if err != nil {
+			log.Println("Failed to skip recurring task " + strconv.FormatInt(id, 10) + ": " + err.Error())
+		}
+	}
+}
+
+// recurringTaskRunner schedules creating the tasks of due templates.
+func recurringTaskRunner() {
+	err := scheduler.AddFunc(config.Recurring.Schedule, func() {
+		runRecurringTasks(time.Now())
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
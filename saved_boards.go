@@ -0,0 +1,492 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// SavedBoard is a named view of a project's tasks with its own columns,
+// filter, sort and swimlanes. Boards are stored server side so a board can
+// be shared by linking to /get/board?id=.
+type SavedBoard struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Columns []string `json:"columns"`
+	Filter BoardFilter `json:"filter"`
+	GroupBy string `json:"group-by"`
+	CreatedBy *int64 `json:"created-by"`
+}
+
+type SavedBoards []SavedBoard
+
+// BoardFilter selects the tasks shown on a saved board. Mine keeps the tasks
+// assigned to whoever views the board, so one "my work" board serves every
+// member of a project. It takes the place of AssigneeIds, so a board can not
+// set both.
+type BoardFilter struct {
+	LabelIds []int64 `json:"label-ids"`
+	AssigneeIds []int64 `json:"assignee-ids"`
+	Mine bool `json:"mine"`
+	Fields []FieldFilter `json:"fields"`
+	Sort *TaskSort `json:"sort"`
+}
+
+// SavedBoardView is a saved board together with its tasks.
+type SavedBoardView struct {
+	Board SavedBoard `json:"board"`
+	View *Board `json:"view"`
+}
+
+// taskQuery turns the filter into a query of the board's project as seen by
+// the user viewing it.
+func (f *BoardFilter) taskQuery(projectId int64, viewerId int64) (*TaskQuery) {
+	tq := &TaskQuery{
+		Id: projectId,
+		LabelIds: f.LabelIds,
+		AssigneeIds: f.AssigneeIds,
+		Fields: append([]FieldFilter{}, f.Fields...),
+		Sort: f.Sort,
+	}
+
+	if f.Mine {
+		tq.AssigneeIds = []int64{viewerId}
+	}
+
+	return tq
+}
+
+func validSavedBoard(b *SavedBoard) (bool, string) {
+	if strings.TrimSpace(b.Name) == "" {
+		return false, "Board name can not be empty"
+	}
+
+	if len(b.Columns) == 0 {
+		return false, "A board needs at least one column"
+	}
+
+	seen := make(set)
+	for _, c := range b.Columns {
+		if strings.TrimSpace(c) == "" {
+			return false, "Board columns can not be empty"
+		}
+
+		if seen.Has(c) {
+			return false, "Board column " + c + " is listed twice"
+		}
+
+		seen.Add(c)
+	}
+
+	if b.Filter.Mine && len(b.Filter.AssigneeIds) > 0 {
+		return false, "A board can filter on assignee-ids or mine, not both"
+	}
+
+	if b.GroupBy != "" && !toSet([]string{"assignee", "priority", "label", "epic"}).Has(b.GroupBy) {
+		return false, "group-by must be empty or one of assignee, priority, label or epic"
+	}
+
+	return true, ""
+}
+
+// checkSavedBoard validates a board and the custom field filters and sort it
+// saves against the fields of its project.
+func checkSavedBoard(b *SavedBoard) (bool, string, error) {
+	if b.Columns == nil {
+		b.Columns = make([]string, 0)
+	}
+
+	ok, message := validSavedBoard(b)
+	if !ok {
+		return false, message, nil
+	}
+
+	tq := b.Filter.taskQuery(b.ProjectId, 0)
+
+	_, err := checkTaskQuery(tq)
+	if qe, ok := err.(*queryError); ok {
+		return false, qe.Error(), nil
+	}
+
+	if err != nil {
+		return false, "", err
+	}
+
+	b.Filter.Fields = tq.Fields
+	return true, "", nil
+}
+
+func scanSavedBoard(row rowScanner) (SavedBoard, error) {
+	b := SavedBoard{}
+	var columns, filter []byte
+	var createdBy sql.NullInt64
+
+	err := row.Scan(&b.Id, &b.ProjectId, &b.Name, &columns, &filter, &b.GroupBy, &createdBy)
+	if err != nil {
+		return b, err
+	}
+
+	if createdBy.Valid {
+		owner := createdBy.Int64
+		b.CreatedBy = &owner
+	}
+
+	err = json.Unmarshal(columns, &b.Columns)
+	if err != nil {
+		return b, err
+	}
+
+	err = json.Unmarshal(filter, &b.Filter)
+	return b, err
+}
+
+var getSavedBoardQuery *sql.Stmt = prepareQuery("sql/get_board.sql")
+
+func getSavedBoard(id int64) (*SavedBoard, error) {
+	b, err := scanSavedBoard(getSavedBoardQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func newSavedBoardHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_board.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var b SavedBoard
+
+		err := json.NewDecoder(r.Body).Decode(&b)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "board",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &b.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message, err = checkSavedBoard(&b)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		columns, _ := json.Marshal(b.Columns)
+		filter, _ := json.Marshal(b.Filter)
+
+		err = stmt.QueryRow(b.ProjectId, b.Name, string(columns), string(filter), b.GroupBy, auId).Scan(&b.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		b.CreatedBy = &auId
+
+		json.NewEncoder(w).Encode(&b)
+	}
+}
+
+func updateSavedBoardHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_board.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var b SavedBoard
+
+		err := json.NewDecoder(r.Body).Decode(&b)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getSavedBoard(b.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Board does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "board",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		b.ProjectId = current.ProjectId
+		b.CreatedBy = current.CreatedBy
+
+		ok, message, err = checkSavedBoard(&b)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		columns, _ := json.Marshal(b.Columns)
+		filter, _ := json.Marshal(b.Filter)
+
+		_, dberr := stmt.Exec(b.Id, b.Name, string(columns), string(filter), b.GroupBy)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&b)
+	}
+}
+
+func deleteSavedBoardHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_board.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var data map[string]int64
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&data)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		boardId, ok := data["id"]
+		if !ok {
+			http.Error(w, "Please include id field with request body", 400)
+			return
+		}
+
+		b, err := getSavedBoard(boardId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Board does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "board",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &b.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(boardId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getProjectSavedBoardsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_boards.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		boards := make(SavedBoards, 0)
+
+		for rows.Next() {
+			b, err := scanSavedBoard(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			boards = append(boards, b)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&boards)
+	}
+}
+
+// getSavedBoardHandler renders the board given by the id param with the
+// tasks that pass its filter, laid out in its columns and swimlanes.
+func getSavedBoardHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["id"] == nil {
+			http.Error(w, "id param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["id"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		b, err := getSavedBoard(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Board does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		lanes, err := boardLanes(b.ProjectId, b.GroupBy)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		// A custom field deleted after the board was saved makes its
+		// filter fail. The board needs editing, the request itself is fine.
+		tasks, err := queryProjectTasks(b.Filter.taskQuery(b.ProjectId, auId))
+
+		if _, ok := err.(*queryError); ok {
+			http.Error(w, err.Error(), 409)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		view := &SavedBoardView{
+			Board: *b,
+			View: buildBoard(b.ProjectId, b.GroupBy, b.Columns, tasks, lanes, lanesOfTask(b.GroupBy)),
+		}
+
+		json.NewEncoder(w).Encode(view)
+	}
+}
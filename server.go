@@ -11,6 +11,7 @@ import (
 	"html/template"
 	"strconv"
 	"strings"
+	"time"
 	_ "github.com/lib/pq"
 )
 
@@ -42,6 +43,8 @@ type Project struct {
 	Id int64 `json:"id"`
 	Name string `json:"name"`
 	CreatedBy int64 `json:"created-by"`
+	Archived bool `json:"archived"`
+	Template bool `json:"template"`
 }
 
 type NewProject struct {
@@ -54,19 +57,80 @@ type Projects []Project
 type Task struct {
 	Id int64 `json:"id"`
 	Name string `json:"name"`
+	Description string `json:"description"`
 	Status string `json:"status"`
 	ProjectId int64 `json:"project-id"`
 	CreatedBy int64 `json:"created-by"`
+	ParentId *int64 `json:"parent-id"`
+	SprintId *int64 `json:"sprint-id"`
+	MilestoneId *int64 `json:"milestone-id"`
+	Points int64 `json:"points"`
+	Priority string `json:"priority"`
+	DueAt *time.Time `json:"due-at"`
+	Progress Progress `json:"progress"`
+	Blocked bool `json:"blocked"`
+	Archived bool `json:"archived"`
+	Labels Labels `json:"labels"`
+	Assignees []int64 `json:"assignees"`
+	CustomFields CustomValues `json:"custom-fields"`
 }
 
+// Progress counts the finished subtasks of a task.
+type Progress struct {
+	Done int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+const maxDescriptionLength = 20000
+
 type NewTask struct {
 	Name string `json:"name"`
+	Description string `json:"description"`
 	CreatedBy int64 `json:"created-by"`
 	ProjectId int64 `json:"project-id"`
+	ParentId *int64 `json:"parent-id"`
 }
 
 type Tasks []Task
 
+// scanTask reads a row from the task list queries, which all select the same columns.
+func scanTask(rows *sql.Rows) (Task, error) {
+	task := Task{}
+	var parentId, sprintId, milestoneId sql.NullInt64
+	var dueAt sql.NullTime
+
+	err := rows.Scan(&task.Id, &task.Name, &task.Description, &task.Status, &parentId, &sprintId, &milestoneId, &task.Points, &task.Priority, &dueAt, &task.Progress.Done, &task.Progress.Total, &task.Blocked, &task.Archived)
+	if err != nil {
+		return task, err
+	}
+
+	if parentId.Valid {
+		id := parentId.Int64
+		task.ParentId = &id
+	}
+
+	if sprintId.Valid {
+		id := sprintId.Int64
+		task.SprintId = &id
+	}
+
+	if milestoneId.Valid {
+		id := milestoneId.Int64
+		task.MilestoneId = &id
+	}
+
+	if dueAt.Valid {
+		t := dueAt.Time
+		task.DueAt = &t
+	}
+
+	task.Labels = make(Labels, 0)
+	task.Assignees = make([]int64, 0)
+	task.CustomFields = make(CustomValues)
+
+	return task, nil
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -113,6 +177,8 @@ func dbConnection() (* sql.DB) {
 		log.Fatal(err.Error())
 	}
 
+	connectionStr = c.ConnectionStr
+
 	db, err = sql.Open(c.Driver, c.ConnectionStr); if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -120,6 +186,10 @@ func dbConnection() (* sql.DB) {
 	return db
 }
 
+// connectionStr is kept for connections outside the pool, such as the
+// LISTEN connection of the realtime stream.
+var connectionStr string
+
 var db *sql.DB = dbConnection()
 
 func getAuthToken(r *http.Request) string {
@@ -493,6 +563,8 @@ func updateProjectNameHandler() func(http.ResponseWriter, *http.Request) {
 			http.Error(w, dberr.Error(), 500)
 			return
 		}
+
+		publishProjectEvent("project.updated", p.Id, auId, &Change{"name", p.Name})
 	}
 }
 
@@ -508,9 +580,23 @@ func getProjectsHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		q := r.URL.Query()
+
+		archived := false
+
+		if q["archived"] != nil {
+			v, err := strconv.ParseBool(q["archived"][0])
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+
+			archived = v
+		}
+
 		projects := make(Projects, 0)
 
-		rows, err := db.Query(query)
+		rows, err := db.Query(query, archived)
 
 		if err != nil {
 			http.Error(w, err.Error(), 500)
@@ -522,7 +608,7 @@ func getProjectsHandler() func(http.ResponseWriter, *http.Request) {
 		for rows.Next() {
 			project := Project{}
 			
-			err := rows.Scan(&project.Id, &project.Name, &project.CreatedBy)
+			err := rows.Scan(&project.Id, &project.Name, &project.CreatedBy, &project.Archived)
 
 			if err != nil {
 				http.Error(w, err.Error(), 500)
@@ -647,18 +733,18 @@ func deleteProjectHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		_, err = stmt.Exec(projectId)
+		_, err = stmt.Exec(projectId, auId)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+
+		publishProjectEvent("project.deleted", projectId, auId, nil)
 	}	
 }
 
 func getProjectTasksHandler() func(http.ResponseWriter, *http.Request) {
 
-	query := loadQuery("sql/get_project_tasks.sql")
-
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		ok, message, _ := requestAuthorized(r)
@@ -672,48 +758,28 @@ func getProjectTasksHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		var p map[string]int64
-		err := json.NewDecoder(r.Body).Decode(&p)
+		var tq TaskQuery
+		err := json.NewDecoder(r.Body).Decode(&tq)
 
 		if err != nil {
 			http.Error(w, err.Error(), 400)
 			return
 		}
 
-		projectId, ok := p["id"]
-		if !ok {
+		if tq.Id == 0 {
 			http.Error(w, "Please include a id field with request body", 400)
 			return
 		}
 
-		rows, err := db.Query(query, projectId)
+		tasks, err := queryProjectTasks(&tq)
 
-		if err != nil {
-			http.Error(w, err.Error(), 500)
+		if _, ok := err.(*queryError); ok {
+			http.Error(w, err.Error(), 400)
 			return
 		}
-		
-		defer rows.Close()
-
-		tasks := make(Tasks, 0)
-
-		for rows.Next() {
-			task := Task{}
-			
-			err := rows.Scan(&task.Id, &task.Name, &task.Status)
-
-			if err != nil {
-				http.Error(w, err.Error(), 500)
-				return
-			}
-
-			tasks = append(tasks, task)
-		}
 
-		err2 := rows.Err()
-
-		if err2 != nil {
-			http.Error(w, err2.Error(), 500)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
 			return
 		}
 				
@@ -721,15 +787,38 @@ func getProjectTasksHandler() func(http.ResponseWriter, *http.Request) {
 	}
 }
 
-func newTaskHandler() func(http.ResponseWriter, *http.Request) {
+var newTaskQuery string = loadQuery("sql/new_task.sql")
 
-	query := loadQuery("sql/new_task.sql")
-	stmt, err := db.Prepare(query)
+// insertTask creates a task in the Todo column and records the mentions in
+// its description, returning the task and the users it newly mentions. The
+// caller commits and then hands both to taskCreated.
+func insertTask(tx *sql.Tx, nt *NewTask, actorId int64) (*Task, []int64, error) {
+	var id int64
+	err := tx.QueryRow(newTaskQuery, nt.Name, nt.Description, "Todo", nt.ProjectId, nt.CreatedBy, nt.ParentId).Scan(&id)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	mentioned, err := recordMentions(tx, id, nil, nt.Description, actorId)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, nil, err
 	}
 
+	task := &Task{Id: id, Name: nt.Name, Description: nt.Description, Status: "Todo", Priority: "none", CreatedBy: nt.CreatedBy, ProjectId: nt.ProjectId, ParentId: nt.ParentId, Labels: make(Labels, 0), Assignees: make([]int64, 0), CustomFields: make(CustomValues)}
+
+	return task, mentioned, nil
+}
+
+// taskCreated notifies the users mentioned by a committed new task and
+// publishes it.
+func taskCreated(task *Task, mentioned []int64, actorId int64) {
+	notifyUsers("mention", task.Id, nil, actorId, nil, mentioned)
+
+	publishTaskEvent("task.created", task.Id, actorId, task)
+}
+
+func newTaskHandler() func(http.ResponseWriter, *http.Request) {
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		ok, message, auId := requestAuthorized(r)
@@ -763,15 +852,53 @@ func newTaskHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}		
 
-		var id int64
-		err2 := stmt.QueryRow(nt.Name, "Todo", nt.ProjectId, nt.CreatedBy).Scan(&id)
+		if nt.ParentId != nil {
+			var parentProjectId int64
+			err := taskProjectQuery.QueryRow(*nt.ParentId).Scan(&parentProjectId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Parent task does not exist", 404)
+				return
+			}
 
-		if err2 != nil {
-			http.Error(w, err2.Error(), 500)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if parentProjectId != nt.ProjectId {
+				http.Error(w, "Parent task belongs to a different project", 400)
+				return
+			}
+		}
+
+		if len(nt.Description) > maxDescriptionLength {
+			http.Error(w, "Task description is longer than " + strconv.Itoa(maxDescriptionLength) + " characters", 400)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		task, mentioned, err := insertTask(tx, &nt, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
 			return
 		}
+
+		taskCreated(task, mentioned, auId)
 				
-		json.NewEncoder(w).Encode(&Task{Id: id, Name: nt.Name, Status: "Todo", CreatedBy: nt.CreatedBy, ProjectId: nt.ProjectId})
+		json.NewEncoder(w).Encode(task)
 	}
 }
 
@@ -823,22 +950,118 @@ func deleteTaskHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}		
 
-		_, dberr := stmt.Exec(taskId)
+		_, dberr := stmt.Exec(taskId, auId)
 		if dberr != nil {
 			http.Error(w, dberr.Error(), 500)
 			return
 		}
+
+		publishTaskEvent("task.deleted", taskId, auId, nil)
+	}
+}
+
+var taskStatusQuery string = loadQuery("sql/update_task_status.sql")
+
+// moveTask moves a task to a status if the project settings allow it,
+// notifying its watchers and publishing the change. It returns false with a
+// message for the user when the move is not allowed, and sql.ErrNoRows when
+// the task does not exist or is in the trash.
+func moveTask(taskId int64, status string, actorId int64) (bool, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, "", err
+	}
+
+	defer tx.Rollback()
+
+	ok, message, err := statusChangeAllowed(tx, taskId, status)
+	if err != nil || !ok {
+		return false, message, err
+	}
+
+	var oldStatus json.RawMessage
+	err = tx.QueryRow(taskStatusQuery, taskId, status, actorId).Scan(&oldStatus)
+	if err == sql.ErrNoRows {
+		// The task is locked, so no row means its status did not change.
+		return true, "", tx.Commit()
+	}
+
+	if err != nil {
+		return false, "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, "", err
 	}
+
+	notifyWatchers("status", taskId, nil, actorId, map[string]interface{}{"old": oldStatus, "new": status}, nil)
+	publishTaskEvent("task.updated", taskId, actorId, &Change{"status", status})
+
+	return true, "", nil
 }
 
 func updateTaskStatusHandler() func(http.ResponseWriter, *http.Request) {
 
-	query := loadQuery("sql/update_task_status.sql")
+	return func (w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var t Task		
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&t)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &t.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}		
+
+		ok, message, err := moveTask(t.Id, t.Status, auId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !ok {
+			http.Error(w, message, 409)
+			return
+		}
+	}
+}
+
+func updateTaskNameHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_name.sql")
 	stmt, err := db.Prepare(query)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	
+
 	return func (w http.ResponseWriter, r *http.Request) {
 
 		ok, message, auId := requestAuthorized(r)
@@ -852,7 +1075,7 @@ func updateTaskStatusHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		var t Task		
+		var t Task
 
 		jsonerr := json.NewDecoder(r.Body).Decode(&t)
 		if jsonerr != nil {
@@ -870,13 +1093,247 @@ func updateTaskStatusHandler() func(http.ResponseWriter, *http.Request) {
 		if !rr.Satisfied() {
 			http.Error(w, "User role is not satisfied for this action", 404)
 			return
-		}		
+		}
+
+		trashed, err := taskTrashed(t.Id)
+		if err == sql.ErrNoRows || (err == nil && trashed) {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if strings.TrimSpace(t.Name) == "" {
+			http.Error(w, "Task name can not be empty", 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(t.Id, t.Name, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", t.Id, auId, &Change{"name", t.Name})
+	}
+}
+
+// updateTaskDescriptionHandler replaces a task's Markdown description. Users
+// mentioned in it start watching the task.
+func updateTaskDescriptionHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_description.sql")
+
+	return func (w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var t Task
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&t)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &t.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		trashed, err := taskTrashed(t.Id)
+		if err == sql.ErrNoRows || (err == nil && trashed) {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if len(t.Description) > maxDescriptionLength {
+			http.Error(w, "Task description is longer than " + strconv.Itoa(maxDescriptionLength) + " characters", 400)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		_, err = tx.Exec(query, t.Id, t.Description, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		mentioned, err := recordMentions(tx, t.Id, nil, t.Description, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		notifyUsers("mention", t.Id, nil, auId, nil, mentioned)
+		publishTaskEvent("task.updated", t.Id, auId, &Change{"description", t.Description})
+	}
+}
+
+// updateTaskDueHandler sets or, with a null due-at, clears a task's due date.
+func updateTaskDueHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_due.sql")
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func (w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
 
-		_, dberr := stmt.Exec(t.Id, t.Status)
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var t Task
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&t)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &t.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		trashed, err := taskTrashed(t.Id)
+		if err == sql.ErrNoRows || (err == nil && trashed) {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		_, dberr := stmt.Exec(t.Id, t.DueAt, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", t.Id, auId, &Change{"due-at", t.DueAt})
+	}
+}
+
+func updateTaskPriorityHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_priority.sql")
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func (w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var t Task
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&t)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &t.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		trashed, err := taskTrashed(t.Id)
+		if err == sql.ErrNoRows || (err == nil && trashed) {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if !toSet(priorities).Has(t.Priority) {
+			http.Error(w, "priority must be one of urgent, high, medium, low or none", 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(t.Id, t.Priority, auId)
 		if dberr != nil {
 			http.Error(w, dberr.Error(), 500)
 			return
 		}
+
+		publishTaskEvent("task.updated", t.Id, auId, &Change{"priority", t.Priority})
 	}
 }
 
@@ -920,11 +1377,15 @@ func assignTaskHandler() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		_, dberr := stmt.Exec(t.TaskId, t.UserId)
+		_, dberr := stmt.Exec(t.UserId, t.TaskId, auId)
 		if dberr != nil {
 			http.Error(w, dberr.Error(), 500)
 			return
 		}
+
+		publishTaskEvent("task.assigned", t.TaskId, auId, &t)
+
+		notifyUsers("assignment", t.TaskId, nil, auId, nil, []int64{t.UserId})
 	}
 }
 
@@ -1114,7 +1575,17 @@ func routes() {
 	http.HandleFunc("/edit/project", updateProjectNameHandler())
 	http.HandleFunc("/delete/project", deleteProjectHandler())
 	http.HandleFunc("/get/projects", getProjectsHandler())
+	http.HandleFunc("/get/project/settings", getProjectSettingsHandler())
+	http.HandleFunc("/update/project/settings", updateProjectSettingsHandler())
 	http.HandleFunc("/get/project/owners", getProjectOwnersHandler())
+	http.HandleFunc("/update/project/archived", archiveHandler("project", "sql/archive_project.sql"))
+	http.HandleFunc("/restore/project", restoreProjectHandler())
+	http.HandleFunc("/new/project/clone", cloneProjectHandler(false))
+	http.HandleFunc("/new/project/template", cloneProjectHandler(true))
+	http.HandleFunc("/get/project/templates", getProjectTemplatesHandler())
+	http.HandleFunc("/new/project/watcher", watchHandler("project", "sql/new_project_watcher.sql"))
+	http.HandleFunc("/delete/project/watcher", watchHandler("project", "sql/delete_project_watcher.sql"))
+	http.HandleFunc("/get/project/watchers", getProjectWatchersHandler())
 
 	// User
 	http.HandleFunc("/new/user", newUserHandler())
@@ -1126,16 +1597,152 @@ func routes() {
 	//Tasks
 	http.HandleFunc("/tasks", tasksPageHandler())
 	http.HandleFunc("/get/project/tasks", getProjectTasksHandler())
+	http.HandleFunc("/get/project/board", getProjectBoardHandler())
+	http.HandleFunc("/get/project/stream", getProjectStreamHandler())
+	http.HandleFunc("/new/board", newSavedBoardHandler())
+	http.HandleFunc("/edit/board", updateSavedBoardHandler())
+	http.HandleFunc("/delete/board", deleteSavedBoardHandler())
+	http.HandleFunc("/get/project/boards", getProjectSavedBoardsHandler())
+	http.HandleFunc("/get/board", getSavedBoardHandler())
 	http.HandleFunc("/new/task", newTaskHandler())
 	http.HandleFunc("/delete/task", deleteTaskHandler())
+	http.HandleFunc("/update/task/archived", archiveHandler("task", "sql/archive_task.sql"))
+	http.HandleFunc("/restore/task", restoreTaskHandler())
+	http.HandleFunc("/get/trash", getTrashHandler())
+	http.HandleFunc("/update/task/name", updateTaskNameHandler())
+	http.HandleFunc("/update/task/description", updateTaskDescriptionHandler())
 	http.HandleFunc("/update/task/status", updateTaskStatusHandler())
+	http.HandleFunc("/get/task/activity", getTaskActivityHandler())
 	http.HandleFunc("/new/task/assignee", assignTaskHandler())
 	http.HandleFunc("/get/task/assignees", getTaskAssigneesHandler())
+	http.HandleFunc("/update/task/parent", updateTaskParentHandler())
+	http.HandleFunc("/get/task/subtasks", getTaskSubtasksHandler())
+	http.HandleFunc("/new/task/link", newTaskLinkHandler())
+	http.HandleFunc("/delete/task/link", deleteTaskLinkHandler())
+	http.HandleFunc("/get/task/links", getTaskLinksHandler())
+	http.HandleFunc("/new/task/watcher", watchHandler("task", "sql/new_task_watcher.sql"))
+	http.HandleFunc("/delete/task/watcher", watchHandler("task", "sql/delete_task_watcher.sql"))
+	http.HandleFunc("/get/task/watchers", getTaskWatchersHandler())
+
+	//Recurring tasks
+	http.HandleFunc("/new/recurring/task", newRecurringTaskHandler())
+	http.HandleFunc("/edit/recurring/task", updateRecurringTaskHandler())
+	http.HandleFunc("/delete/recurring/task", deleteRecurringTaskHandler())
+	http.HandleFunc("/get/project/recurring/tasks", getProjectRecurringTasksHandler())
+
+	//Sprints
+	http.HandleFunc("/new/sprint", newSprintHandler())
+	http.HandleFunc("/edit/sprint", updateSprintHandler())
+	http.HandleFunc("/start/sprint", startSprintHandler())
+	http.HandleFunc("/close/sprint", closeSprintHandler())
+	http.HandleFunc("/delete/sprint", deleteSprintHandler())
+	http.HandleFunc("/get/project/sprints", getProjectSprintsHandler())
+	http.HandleFunc("/update/task/sprint", updateTaskSprintHandler())
+
+	//Milestones
+	http.HandleFunc("/new/milestone", newMilestoneHandler())
+	http.HandleFunc("/edit/milestone", updateMilestoneHandler())
+	http.HandleFunc("/delete/milestone", deleteMilestoneHandler())
+	http.HandleFunc("/get/milestones", getMilestonesHandler())
+	http.HandleFunc("/get/milestone/tasks", getMilestoneTasksHandler())
+	http.HandleFunc("/update/task/milestone", updateTaskMilestoneHandler())
+	http.HandleFunc("/update/task/points", updateTaskPointsHandler())
+	http.HandleFunc("/update/task/priority", updateTaskPriorityHandler())
+	http.HandleFunc("/update/task/due", updateTaskDueHandler())
+
+	//Custom fields
+	http.HandleFunc("/new/custom/field", newCustomFieldHandler())
+	http.HandleFunc("/edit/custom/field", updateCustomFieldHandler())
+	http.HandleFunc("/delete/custom/field", deleteCustomFieldHandler())
+	http.HandleFunc("/get/project/custom/fields", getProjectCustomFieldsHandler())
+	http.HandleFunc("/update/task/custom/field", setTaskCustomValueHandler())
+
+	//Checklists
+	http.HandleFunc("/new/checklist/item", newChecklistItemHandler())
+	http.HandleFunc("/edit/checklist/item", updateChecklistItemHandler())
+	http.HandleFunc("/delete/checklist/item", deleteChecklistItemHandler())
+	http.HandleFunc("/get/task/checklist", getTaskChecklistHandler())
+
+	//Labels
+	http.HandleFunc("/new/label", newLabelHandler())
+	http.HandleFunc("/edit/label", updateLabelHandler())
+	http.HandleFunc("/delete/label", deleteLabelHandler())
+	http.HandleFunc("/get/project/labels", getProjectLabelsHandler())
+	http.HandleFunc("/new/task/label", addTaskLabelHandler())
+	http.HandleFunc("/delete/task/label", removeTaskLabelHandler())
+
+	//Comments
+	http.HandleFunc("/new/comment", newCommentHandler())
+	http.HandleFunc("/edit/comment", updateCommentHandler())
+	http.HandleFunc("/delete/comment", deleteCommentHandler())
+	http.HandleFunc("/get/task/comments", getTaskCommentsHandler())
+	http.HandleFunc("/get/comment/revisions", getCommentRevisionsHandler())
+
+	//Attachments
+	http.HandleFunc("/new/task/attachment", newAttachmentHandler())
+	http.HandleFunc("/get/task/attachments", getTaskAttachmentsHandler())
+	http.HandleFunc("/get/attachment", downloadAttachmentHandler())
+	http.HandleFunc("/delete/attachment", deleteAttachmentHandler())
+
+	//Notifications
+	http.HandleFunc("/get/notifications", getNotificationsHandler())
+	http.HandleFunc("/get/notifications/unread", getUnreadNotificationsHandler())
+	http.HandleFunc("/update/notification/read", readNotificationHandler())
+	http.HandleFunc("/update/notifications/read", readAllNotificationsHandler())
+	http.HandleFunc("/get/user/email/settings", getEmailSettingsHandler())
+	http.HandleFunc("/update/user/email/settings", updateEmailSettingsHandler())
+	http.HandleFunc("/unsubscribe", unsubscribeHandler())
+
+	//Webhooks
+	http.HandleFunc("/new/webhook", newWebhookHandler())
+	http.HandleFunc("/edit/webhook", updateWebhookHandler())
+	http.HandleFunc("/delete/webhook", deleteWebhookHandler())
+	http.HandleFunc("/get/project/webhooks", getProjectWebhooksHandler())
+	http.HandleFunc("/get/webhook/deliveries", getWebhookDeliveriesHandler())
+	http.HandleFunc("/redeliver/webhook", redeliverWebhookHandler())
+
+	//Automation
+	http.HandleFunc("/new/rule", newRuleHandler())
+	http.HandleFunc("/edit/rule", updateRuleHandler())
+	http.HandleFunc("/delete/rule", deleteRuleHandler())
+	http.HandleFunc("/get/project/rules", getProjectRulesHandler())
+	http.HandleFunc("/get/rule/runs", getRuleRunsHandler())
+
+	//Calendar feeds
+	http.HandleFunc("/new/calendar/feed", newCalendarFeedHandler())
+	http.HandleFunc("/delete/calendar/feed", deleteCalendarFeedHandler())
+	http.HandleFunc("/get/calendar/feeds", getCalendarFeedsHandler())
+	http.HandleFunc("/calendar.ics", calendarHandler())
+
+	//Activity feeds
+	http.HandleFunc("/new/project/feed", newActivityFeedHandler())
+	http.HandleFunc("/delete/project/feed", deleteActivityFeedHandler())
+	http.HandleFunc("/get/project/feeds", getProjectActivityFeedsHandler())
+	http.HandleFunc("/activity.atom", activityFeedHandler())
+
+	//Chat
+	http.HandleFunc("/chat/command", chatCommandHandler())
+	http.HandleFunc("/new/chat/link/code", newChatLinkCodeHandler())
+
+	//Intakes
+	http.HandleFunc("/new/intake", newIntakeHandler())
+	http.HandleFunc("/edit/intake", updateIntakeHandler())
+	http.HandleFunc("/delete/intake", deleteIntakeHandler())
+	http.HandleFunc("/get/project/intakes", getProjectIntakesHandler())
+	http.HandleFunc("/intake", intakeHandler())
 	
 }
 
 func main() {
 	auth.GarbageCollector()
+	trashPurger()
+	recurringTaskRunner()
+	dueDateNotifier()
+	emailNotifier()
+	webhookDispatcher()
+	realtimeListener()
+	automationRunner()
+	scheduler.Start()
 	routes()
 	fmt.Println("Running Kanelm server at port 8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"strconv"
+	"time"
 )
 
 func newUser(t *testing.T) (*User) {
@@ -406,6 +407,41 @@ func getTaskAssignees(t *testing.T, task *Task) (TaskAssignees) {
 	return taskAssignees
 }
 
+func getTaskActivity(t *testing.T, task *Task) (*TaskActivityPage) {
+	server := httptest.NewServer(http.HandlerFunc(getTaskActivityHandler()))
+	defer server.Close()
+	
+	req, err := http.NewRequest("GET", server.URL, nil)
+	q := req.URL.Query()
+	q.Add("taskid", strconv.FormatInt(task.Id, 10))
+	req.URL.RawQuery = q.Encode()
+	
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+
+	if err != nil {
+		t.Fatal("Get task activity failed with", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		t.Fatal("Get task activity has error", string(body))
+	}	
+	
+	var page TaskActivityPage
+	err2 := json.NewDecoder(resp.Body).Decode(&page)
+
+	if err2 != nil {
+		t.Fatal("Decoding task activity failed", err2.Error())
+	}
+
+	return &page
+}
+
 func assignTask(t *testing.T, task *Task, user *User) {
 	server := httptest.NewServer(http.HandlerFunc(assignTaskHandler()))
 	defer server.Close()
@@ -501,6 +537,10 @@ func TestIntegrationApi(t *testing.T) {
 
 	taskAssignees := getTaskAssignees(t, task)
 
+	if len(taskAssignees) != 1 {
+		t.Fatal("Task should have one assignee, but it has", len(taskAssignees))
+	}
+
 	if taskAssignees[0].TaskId != task.Id {
 		t.Fatal("Task assignee task id is incorrect")
 	}
@@ -509,6 +549,18 @@ func TestIntegrationApi(t *testing.T) {
 		t.Fatal("Task assignee user id is incorrect")
 	}
 
+	var assignedId int64
+
+	for _, a := range getTaskActivity(t, task).Activity {
+		if a.Field == "assignee" {
+			json.Unmarshal(a.NewValue, &assignedId)
+		}
+	}
+
+	if assignedId != user.Id {
+		t.Fatal("Task activity should record user", user.Id, "as assigned, but it recorded", assignedId)
+	}
+
 	// TEARDOWN
 
 	// Tasks
@@ -551,6 +603,14 @@ func TestIntegrationApi(t *testing.T) {
 		t.Fatal("Project owners length should be zero, but it is", n)
 	}
 
+	// Trash
+
+	err := purgeTrash(time.Now())
+
+	if err != nil {
+		t.Fatal("Purge trash has error", err.Error())
+	}
+
 	// Users
 
 	deleteUser(t, user)
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sprint dates are calendar days formatted as 2006-01-02.
+type Sprint struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	Name string `json:"name"`
+	Status string `json:"status"`
+	StartsOn string `json:"starts-on"`
+	EndsOn string `json:"ends-on"`
+}
+
+type Sprints []Sprint
+
+type SprintClosure struct {
+	SprintId int64 `json:"sprint-id"`
+	NextSprintId *int64 `json:"next-sprint-id"`
+	Moved int64 `json:"moved"`
+}
+
+type TaskSprint struct {
+	Id int64 `json:"id"`
+	SprintId *int64 `json:"sprint-id"`
+}
+
+const dateLayout = "2006-01-02"
+
+func validSprint(s *Sprint) (bool, string) {
+	if strings.TrimSpace(s.Name) == "" {
+		return false, "Sprint name can not be empty"
+	}
+
+	start, err := time.Parse(dateLayout, s.StartsOn)
+	if err != nil {
+		return false, "starts-on must be a date like 2006-01-02"
+	}
+
+	end, err := time.Parse(dateLayout, s.EndsOn)
+	if err != nil {
+		return false, "ends-on must be a date like 2006-01-02"
+	}
+
+	if end.Before(start) {
+		return false, "Sprint can not end before it starts"
+	}
+
+	return true, ""
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSprint(row rowScanner) (Sprint, error) {
+	s := Sprint{}
+	var start, end time.Time
+
+	err := row.Scan(&s.Id, &s.ProjectId, &s.Name, &s.Status, &start, &end)
+	if err != nil {
+		return s, err
+	}
+
+	s.StartsOn = start.Format(dateLayout)
+	s.EndsOn = end.Format(dateLayout)
+
+	return s, nil
+}
+
+var getSprintQuery *sql.Stmt = prepareQuery("sql/get_sprint.sql")
+
+func getSprint(id int64) (*Sprint, error) {
+	s, err := scanSprint(getSprintQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+var checkActiveSprintQuery *sql.Stmt = prepareQuery("sql/check_active_sprint.sql")
+
+// sprintRequest loads the sprint named by the id field of the request body
+// and checks the active user may run action on it.
+func sprintRequest(w http.ResponseWriter, r *http.Request, action string) (*Sprint, map[string]int64, int64, bool) {
+
+	ok, message, auId := requestAuthorized(r)
+	if !ok {
+		http.Error(w, message, 404)
+		return nil, nil, 0, false
+	}
+
+	if r.Body == nil {
+		http.Error(w, "Please send a request body", 400)
+		return nil, nil, 0, false
+	}
+
+	var data map[string]int64
+
+	jsonerr := json.NewDecoder(r.Body).Decode(&data)
+	if jsonerr != nil {
+		http.Error(w, jsonerr.Error(), 400)
+		return nil, nil, 0, false
+	}
+
+	sprintId, ok := data["id"]
+	if !ok {
+		http.Error(w, "Please include id field with request body", 400)
+		return nil, nil, 0, false
+	}
+
+	s, err := getSprint(sprintId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Sprint does not exist", 404)
+		return nil, nil, 0, false
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return nil, nil, 0, false
+	}
+
+	rr := &RoleRequest{
+		Entity: "sprint",
+		Action: action,
+		ActiveUserId: auId,
+		ProjectId: &s.ProjectId,
+	}
+
+	if !rr.Satisfied() {
+		http.Error(w, "User role is not satisfied for this action", 404)
+		return nil, nil, 0, false
+	}
+
+	return s, data, auId, true
+}
+
+func newSprintHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_sprint.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var s Sprint
+
+		err := json.NewDecoder(r.Body).Decode(&s)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "sprint",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &s.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validSprint(&s)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		s.Status = "planned"
+
+		err = stmt.QueryRow(s.ProjectId, s.Name, s.StartsOn, s.EndsOn).Scan(&s.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&s)
+	}
+}
+
+func updateSprintHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_sprint.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var s Sprint
+
+		err := json.NewDecoder(r.Body).Decode(&s)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getSprint(s.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Sprint does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "sprint",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validSprint(&s)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		_, dberr := stmt.Exec(s.Id, s.Name, s.StartsOn, s.EndsOn)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		s.ProjectId = current.ProjectId
+		s.Status = current.Status
+
+		json.NewEncoder(w).Encode(&s)
+	}
+}
+
+func startSprintHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_sprint_status.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		s, _, _, ok := sprintRequest(w, r, "update")
+		if !ok {
+			return
+		}
+
+		if s.Status != "planned" {
+			http.Error(w, "Only planned sprints can be started", 409)
+			return
+		}
+
+		var active bool
+		err := checkActiveSprintQuery.QueryRow(s.ProjectId).Scan(&active)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if active {
+			http.Error(w, "Project already has an active sprint", 409)
+			return
+		}
+
+		_, dberr := stmt.Exec(s.Id, "active")
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		s.Status = "active"
+
+		json.NewEncoder(w).Encode(s)
+	}
+}
+
+// closeSprintHandler closes a sprint and rolls its unfinished tasks into
+// next-sprint-id, or the earliest planned sprint of the project when none
+// is given. Without a planned sprint the tasks return to the backlog.
+func closeSprintHandler() func(http.ResponseWriter, *http.Request) {
+
+	statusQuery := loadQuery("sql/update_sprint_status.sql")
+	rollQuery := loadQuery("sql/roll_sprint_tasks.sql")
+	nextQuery := loadQuery("sql/get_next_planned_sprint.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		s, data, auId, ok := sprintRequest(w, r, "update")
+		if !ok {
+			return
+		}
+
+		if s.Status == "closed" {
+			http.Error(w, "Sprint is already closed", 409)
+			return
+		}
+
+		closure := &SprintClosure{SprintId: s.Id}
+
+		if nextId, ok := data["next-sprint-id"]; ok {
+			next, err := getSprint(nextId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Next sprint does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if next.ProjectId != s.ProjectId || next.Id == s.Id || next.Status == "closed" {
+				http.Error(w, "Next sprint must be another open sprint of the same project", 400)
+				return
+			}
+
+			closure.NextSprintId = &next.Id
+		} else {
+			var nextId int64
+			err := db.QueryRow(nextQuery, s.ProjectId, s.Id).Scan(&nextId)
+			if err != nil && err != sql.ErrNoRows {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if err == nil {
+				closure.NextSprintId = &nextId
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer tx.Rollback()
+
+		_, err = tx.Exec(statusQuery, s.Id, "closed")
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		res, err := tx.Exec(rollQuery, s.Id, closure.NextSprintId, auId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		closure.Moved, err = res.RowsAffected()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(closure)
+	}
+}
+
+func deleteSprintHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_sprint.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		s, _, _, ok := sprintRequest(w, r, "delete")
+		if !ok {
+			return
+		}
+
+		_, dberr := stmt.Exec(s.Id)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+func getProjectSprintsHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_sprints.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		sprints := make(Sprints, 0)
+
+		for rows.Next() {
+			s, err := scanSprint(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			sprints = append(sprints, s)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&sprints)
+	}
+}
+
+func updateTaskSprintHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_sprint.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var ts TaskSprint
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&ts)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		var projectId int64
+		err := taskProjectQuery.QueryRow(ts.Id).Scan(&projectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+			TaskId: &ts.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if ts.SprintId != nil {
+			s, err := getSprint(*ts.SprintId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Sprint does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if s.ProjectId != projectId {
+				http.Error(w, "Sprint belongs to a different project", 400)
+				return
+			}
+
+			if s.Status == "closed" {
+				http.Error(w, "Tasks can not be added to a closed sprint", 409)
+				return
+			}
+		}
+
+		_, dberr := stmt.Exec(ts.Id, ts.SprintId, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", ts.Id, auId, &Change{"sprint-id", ts.SprintId})
+	}
+}
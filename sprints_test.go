@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidSprint(t *testing.T) {
+	ok, _ := validSprint(&Sprint{Name: "Sprint 1", StartsOn: "2026-10-05", EndsOn: "2026-10-16"})
+	if !ok {
+		t.Fatal("A two week sprint should be valid")
+	}
+
+	ok, _ = validSprint(&Sprint{Name: "Sprint 2", StartsOn: "2026-10-16", EndsOn: "2026-10-05"})
+	if ok {
+		t.Fatal("A sprint ending before it starts should be invalid")
+	}
+
+	ok, _ = validSprint(&Sprint{Name: "Sprint 3", StartsOn: "10/05/2026", EndsOn: "2026-10-16"})
+	if ok {
+		t.Fatal("Dates not formatted as 2006-01-02 should be invalid")
+	}
+
+	ok, _ = validSprint(&Sprint{Name: " ", StartsOn: "2026-10-05", EndsOn: "2026-10-16"})
+	if ok {
+		t.Fatal("A sprint without a name should be invalid")
+	}
+}
@@ -0,0 +1 @@
+UPDATE projects SET archived_at = CASE WHEN $2::boolean THEN COALESCE(archived_at, NOW()) END WHERE id = $1;
@@ -0,0 +1,9 @@
+WITH previous AS (
+ SELECT id, tasks.archived_at IS NOT NULL AS value FROM tasks WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+), updated AS (
+ UPDATE tasks SET archived_at = CASE WHEN $2::boolean THEN COALESCE(tasks.archived_at, NOW()) END, updated_by = $3, updated_at = NOW() FROM previous WHERE tasks.id = previous.id
+ RETURNING tasks.id, previous.value AS old_value, tasks.archived_at IS NOT NULL AS new_value
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT id, $3, 'archived', to_jsonb(old_value), to_jsonb(new_value), NOW() FROM updated
+WHERE old_value IS DISTINCT FROM new_value;
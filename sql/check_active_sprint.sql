@@ -0,0 +1 @@
+SELECT EXISTS (SELECT * FROM sprints WHERE project_id = $1 AND status = 'active');
@@ -1 +1 @@
-SELECT admin_user FROM users WHERE id = $1 LIMIT 1;
+SELECT COALESCE(admin_user, false) FROM users WHERE id = $1 LIMIT 1;
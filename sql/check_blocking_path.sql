@@ -0,0 +1,8 @@
+WITH RECURSIVE blocked AS (
+ SELECT target_task_id FROM task_links WHERE source_task_id = $1 AND kind = 'blocks'
+ UNION
+ SELECT task_links.target_task_id FROM task_links
+ JOIN blocked ON task_links.source_task_id = blocked.target_task_id
+ WHERE task_links.kind = 'blocks'
+)
+SELECT EXISTS (SELECT * FROM blocked WHERE target_task_id = $2);
@@ -0,0 +1 @@
+SELECT EXISTS(SELECT * FROM comments WHERE id = $1 AND author_id = $2 LIMIT 1);
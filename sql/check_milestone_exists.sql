@@ -0,0 +1 @@
+SELECT EXISTS (SELECT * FROM milestones WHERE id = $1);
@@ -0,0 +1,6 @@
+WITH RECURSIVE ancestors AS (
+ SELECT id, parent_id FROM tasks WHERE id = $1
+ UNION
+ SELECT tasks.id, tasks.parent_id FROM tasks JOIN ancestors ON tasks.id = ancestors.parent_id
+)
+SELECT EXISTS (SELECT * FROM ancestors WHERE id = $2);
@@ -0,0 +1,4 @@
+SELECT EXISTS (
+ SELECT * FROM task_links JOIN tasks AS blocker ON blocker.id = task_links.source_task_id
+ WHERE task_links.target_task_id = $1 AND task_links.kind = 'blocks' AND blocker.status <> 'Done' AND blocker.deleted_at IS NULL
+);
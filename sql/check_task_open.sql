@@ -0,0 +1 @@
+SELECT EXISTS (SELECT * FROM tasks WHERE id = $1 AND status <> 'Done' AND deleted_at IS NULL);
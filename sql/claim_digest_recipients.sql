@@ -0,0 +1,11 @@
+UPDATE email_settings SET digest_sent_at = $2
+FROM users, (
+ SELECT user_id, digest_sent_at FROM email_settings
+ WHERE digest
+  AND (digest_sent_at IS NULL OR digest_sent_at < $1)
+ ORDER BY user_id
+ FOR UPDATE SKIP LOCKED
+) claimed
+WHERE email_settings.user_id = claimed.user_id
+ AND users.id = email_settings.user_id
+RETURNING email_settings.user_id, email_settings.email, email_settings.unsubscribe_token, users.name, claimed.digest_sent_at;
@@ -0,0 +1,25 @@
+UPDATE notifications SET emailed_at = $2
+FROM email_settings, users AS recipients, tasks, projects, (
+ SELECT notifications.id FROM notifications
+ JOIN email_settings ON email_settings.user_id = notifications.user_id
+ JOIN tasks ON tasks.id = notifications.task_id
+ JOIN projects ON projects.id = tasks.project_id
+ WHERE notifications.emailed_at IS NULL
+  AND notifications.read_at IS NULL
+  AND notifications.created_at > $1
+  AND ((notifications.kind = 'assignment' AND email_settings.assignments)
+   OR (notifications.kind = 'mention' AND email_settings.mentions))
+  AND tasks.deleted_at IS NULL
+  AND projects.deleted_at IS NULL
+ ORDER BY notifications.id
+ LIMIT 100
+ FOR UPDATE OF notifications SKIP LOCKED
+) claimed
+WHERE notifications.id = claimed.id
+ AND email_settings.user_id = notifications.user_id
+ AND recipients.id = notifications.user_id
+ AND tasks.id = notifications.task_id
+ AND projects.id = tasks.project_id
+RETURNING notifications.id, notifications.kind, email_settings.email, email_settings.unsubscribe_token,
+ recipients.id, recipients.name, tasks.name, projects.id, projects.name,
+ (SELECT actors.name FROM users AS actors WHERE actors.id = notifications.actor_id);
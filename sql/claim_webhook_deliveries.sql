@@ -0,0 +1,14 @@
+UPDATE webhook_deliveries SET attempts = webhook_deliveries.attempts + 1, next_attempt_at = $2
+FROM webhooks
+WHERE webhooks.id = webhook_deliveries.webhook_id
+ AND webhook_deliveries.id IN (
+  SELECT webhook_deliveries.id FROM webhook_deliveries
+  JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+  WHERE webhook_deliveries.status = 'pending'
+   AND webhook_deliveries.next_attempt_at <= $1
+   AND webhooks.active
+  ORDER BY webhook_deliveries.next_attempt_at
+  LIMIT $3
+  FOR UPDATE OF webhook_deliveries SKIP LOCKED
+ )
+RETURNING webhook_deliveries.id, webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.attempts, webhooks.url, webhooks.secret;
@@ -1,5 +1,34 @@
+DROP TABLE chat_link_codes;
+DROP TABLE chat_links;
+DROP TABLE activity_feeds;
+DROP TABLE calendar_feeds;
+DROP TABLE rule_runs;
+DROP TABLE rules;
+DROP TABLE intake_items;
+DROP TABLE intakes;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE recurring_tasks;
+DROP TABLE boards;
+DROP TABLE task_custom_values;
+DROP TABLE custom_fields;
+DROP TABLE task_links;
+DROP TABLE checklist_items;
+DROP TABLE attachments;
+DROP TABLE email_settings;
+DROP TABLE notifications;
+DROP TABLE mentions;
+DROP TABLE project_watchers;
+DROP TABLE task_watchers;
+DROP TABLE comment_revisions;
+DROP TABLE comments;
+DROP TABLE task_labels;
+DROP TABLE labels;
 DROP TABLE task_assignees;
+DROP TABLE task_events;
 DROP TABLE tasks;
+DROP TABLE sprints;
+DROP TABLE milestones;
 DROP TABLE project_owners;
 DROP TABLE projects;
 DROP TABLE login;
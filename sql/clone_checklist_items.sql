@@ -0,0 +1,4 @@
+INSERT INTO checklist_items (task_id, text, done, position, created_at)
+SELECT ($1::jsonb ->> task_id::text)::integer, text, done, position, NOW()
+FROM checklist_items
+WHERE $1::jsonb ? task_id::text;
@@ -0,0 +1,6 @@
+WITH source AS (
+ SELECT id, name, kind, options FROM custom_fields WHERE project_id = $1
+), cloned AS (
+ INSERT INTO custom_fields (project_id, name, kind, options, created_at) SELECT $2, name, kind, options, NOW() FROM source RETURNING id, name
+)
+SELECT source.id, cloned.id FROM source JOIN cloned ON cloned.name = source.name;
@@ -0,0 +1,6 @@
+WITH source AS (
+ SELECT id, name, color FROM labels WHERE project_id = $1
+), cloned AS (
+ INSERT INTO labels (project_id, name, color, created_at) SELECT $2, name, color, NOW() FROM source RETURNING id, name
+)
+SELECT source.id, cloned.id FROM source JOIN cloned ON cloned.name = source.name;
@@ -0,0 +1,3 @@
+INSERT INTO projects (name, created_by, block_parent_done, block_blocked_start, is_template, created_at)
+SELECT $2, $3, block_parent_done, block_blocked_start, $4, NOW() FROM projects WHERE id = $1 AND deleted_at IS NULL
+RETURNING id;
@@ -0,0 +1,2 @@
+INSERT INTO project_owners (project_id, user_id, created_at)
+SELECT DISTINCT $2::integer, user_id, NOW() FROM project_owners WHERE project_id = $1 AND user_id <> $3;
@@ -0,0 +1,2 @@
+INSERT INTO tasks (name, description, status, project_id, created_by, priority, points, archived_at, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $8::boolean THEN NOW() END, NOW()) RETURNING id;
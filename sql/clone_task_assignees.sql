@@ -0,0 +1,4 @@
+INSERT INTO task_assignees (user_id, task_id, created_at)
+SELECT user_id, ($1::jsonb ->> task_id::text)::integer, NOW()
+FROM task_assignees
+WHERE $1::jsonb ? task_id::text;
@@ -0,0 +1,4 @@
+INSERT INTO task_custom_values (task_id, field_id, value, created_at)
+SELECT ($1::jsonb ->> task_id::text)::integer, ($2::jsonb ->> field_id::text)::integer, value, NOW()
+FROM task_custom_values
+WHERE $1::jsonb ? task_id::text AND $2::jsonb ? field_id::text;
@@ -0,0 +1,4 @@
+INSERT INTO task_labels (task_id, label_id, created_at)
+SELECT ($1::jsonb ->> task_id::text)::integer, ($2::jsonb ->> label_id::text)::integer, NOW()
+FROM task_labels
+WHERE $1::jsonb ? task_id::text AND $2::jsonb ? label_id::text;
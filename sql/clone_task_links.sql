@@ -0,0 +1,4 @@
+INSERT INTO task_links (source_task_id, target_task_id, kind, created_by, created_at)
+SELECT ($1::jsonb ->> source_task_id::text)::integer, ($1::jsonb ->> target_task_id::text)::integer, kind, $2, NOW()
+FROM task_links
+WHERE $1::jsonb ? source_task_id::text AND $1::jsonb ? target_task_id::text;
@@ -0,0 +1,3 @@
+UPDATE tasks SET parent_id = ($1::jsonb ->> source.parent_id::text)::integer
+FROM tasks AS source
+WHERE tasks.id = ($1::jsonb ->> source.id::text)::integer AND source.parent_id IS NOT NULL;
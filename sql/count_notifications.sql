@@ -0,0 +1,6 @@
+SELECT COUNT(*), COUNT(*) FILTER (WHERE notifications.read_at IS NULL)
+FROM notifications
+JOIN tasks ON tasks.id = notifications.task_id
+WHERE notifications.user_id = $1
+ AND tasks.deleted_at IS NULL
+ AND (NOT $2::boolean OR notifications.read_at IS NULL);
@@ -0,0 +1 @@
+SELECT COUNT(*) FROM tasks WHERE parent_id = $1 AND status <> 'Done' AND deleted_at IS NULL;
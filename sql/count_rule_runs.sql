@@ -0,0 +1 @@
+SELECT COUNT(*) FROM rule_runs WHERE rule_id = $1;
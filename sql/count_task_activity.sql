@@ -0,0 +1 @@
+SELECT 1 + (SELECT COUNT(*) FROM task_events WHERE task_id = $1) + (SELECT COUNT(*) FROM comments WHERE task_id = $1);
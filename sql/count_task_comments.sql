@@ -0,0 +1 @@
+SELECT COUNT(*) FROM comments WHERE task_id = $1 AND parent_id IS NULL;
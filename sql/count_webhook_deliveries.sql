@@ -0,0 +1 @@
+SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = $1;
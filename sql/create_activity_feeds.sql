@@ -0,0 +1,7 @@
+CREATE TABLE activity_feeds(
+ id serial PRIMARY KEY,
+ project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+ token text NOT NULL UNIQUE,
+ created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ created_at TIMESTAMP NOT NULL
+);
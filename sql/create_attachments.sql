@@ -0,0 +1,10 @@
+CREATE TABLE attachments(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ uploaded_by INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ filename text NOT NULL,
+ content_type text NOT NULL,
+ size bigint NOT NULL,
+ storage_key text NOT NULL UNIQUE,
+ created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE boards(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ columns jsonb NOT NULL,
+ filter jsonb NOT NULL DEFAULT '{}',
+ group_by text NOT NULL DEFAULT '',
+ created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP,
+ UNIQUE (project_id, name)
+);
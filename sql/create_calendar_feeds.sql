@@ -0,0 +1,7 @@
+CREATE TABLE calendar_feeds(
+ id serial PRIMARY KEY,
+ user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ token text NOT NULL UNIQUE,
+ created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE chat_link_codes(
+ code text PRIMARY KEY,
+ user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ expires_at TIMESTAMP NOT NULL,
+ created_at TIMESTAMP NOT NULL
+);
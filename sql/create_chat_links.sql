@@ -0,0 +1,7 @@
+CREATE TABLE chat_links(
+ team_id text NOT NULL,
+ chat_user_id text NOT NULL,
+ user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ PRIMARY KEY (team_id, chat_user_id)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE checklist_items(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ text text NOT NULL,
+ done bool NOT NULL DEFAULT false,
+ position INTEGER NOT NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
@@ -0,0 +1,7 @@
+CREATE TABLE comment_revisions(
+ id serial PRIMARY KEY,
+ comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+ edited_by INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ body text NOT NULL,
+ created_at TIMESTAMP NOT NULL
+);
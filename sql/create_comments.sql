@@ -0,0 +1,9 @@
+CREATE TABLE comments(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+ author_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ body text NOT NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
@@ -0,0 +1,11 @@
+CREATE TABLE custom_fields(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ kind text NOT NULL,
+ options jsonb NOT NULL DEFAULT '[]',
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP,
+ UNIQUE (project_id, name),
+ CHECK (kind IN ('text', 'number', 'date', 'single-select', 'multi-select', 'user'))
+);
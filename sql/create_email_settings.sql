@@ -0,0 +1,11 @@
+CREATE TABLE email_settings(
+ user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+ email text NOT NULL,
+ assignments bool NOT NULL DEFAULT true,
+ mentions bool NOT NULL DEFAULT true,
+ digest bool NOT NULL DEFAULT false,
+ unsubscribe_token text NOT NULL UNIQUE,
+ digest_sent_at TIMESTAMP,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
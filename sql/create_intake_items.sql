@@ -0,0 +1,8 @@
+CREATE TABLE intake_items(
+ id serial PRIMARY KEY,
+ intake_id INTEGER REFERENCES intakes(id) ON DELETE CASCADE,
+ external_id text NOT NULL,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ UNIQUE (intake_id, external_id)
+);
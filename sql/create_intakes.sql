@@ -0,0 +1,11 @@
+CREATE TABLE intakes(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ token text NOT NULL UNIQUE,
+ mapping jsonb NOT NULL,
+ active bool NOT NULL DEFAULT true,
+ created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
@@ -0,0 +1,9 @@
+CREATE TABLE labels(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ color text NOT NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP,
+ UNIQUE (project_id, name)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE mentions(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+ user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ mentioned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ created_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX mentions_source ON mentions (task_id, COALESCE(comment_id, 0), user_id);
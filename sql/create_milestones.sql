@@ -0,0 +1,9 @@
+CREATE TABLE milestones(
+ id serial PRIMARY KEY,
+ created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ name text NOT NULL,
+ description text NOT NULL DEFAULT '',
+ target_date DATE NOT NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
@@ -0,0 +1,19 @@
+CREATE TABLE notifications(
+ id serial PRIMARY KEY,
+ user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ kind text NOT NULL,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+ actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ data jsonb,
+ read_at TIMESTAMP,
+ emailed_at TIMESTAMP,
+ created_at TIMESTAMP NOT NULL,
+ CHECK (kind IN ('assignment', 'status', 'comment', 'mention', 'due-soon', 'overdue', 'escalation'))
+);
+
+CREATE INDEX notifications_user ON notifications (user_id, created_at);
+
+CREATE INDEX notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE UNIQUE INDEX notifications_due ON notifications (user_id, task_id, kind, (data ->> 'due-at')) WHERE kind IN ('due-soon', 'overdue', 'escalation');
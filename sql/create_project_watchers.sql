@@ -0,0 +1,7 @@
+CREATE TABLE project_watchers(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ UNIQUE (project_id, user_id)
+);
@@ -2,6 +2,12 @@ CREATE TABLE projects(
  id serial PRIMARY KEY,
  created_by INTEGER REFERENCES users(id),
  name text,
+ block_parent_done bool NOT NULL DEFAULT false,
+ block_blocked_start bool NOT NULL DEFAULT false,
+ is_template bool NOT NULL DEFAULT false,
+ archived_at TIMESTAMP,
+ deleted_at TIMESTAMP,
+ deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
  created_at TIMESTAMP NOT NULL,
  updated_at TIMESTAMP
 );
@@ -0,0 +1,20 @@
+CREATE TABLE recurring_tasks(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ schedule text NOT NULL,
+ starts_at TIMESTAMP NOT NULL,
+ skip_if_open bool NOT NULL DEFAULT true,
+ priority text NOT NULL DEFAULT 'none',
+ points INTEGER NOT NULL DEFAULT 0,
+ label_ids jsonb NOT NULL DEFAULT '[]',
+ assignee_ids jsonb NOT NULL DEFAULT '[]',
+ custom_fields jsonb NOT NULL DEFAULT '{}',
+ next_run_at TIMESTAMP,
+ last_run_at TIMESTAMP,
+ last_task_id INTEGER REFERENCES tasks(id) ON DELETE SET NULL,
+ created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP,
+ CHECK (priority IN ('none', 'low', 'medium', 'high', 'urgent'))
+);
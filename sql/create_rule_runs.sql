@@ -0,0 +1,16 @@
+CREATE TABLE rule_runs(
+ id serial PRIMARY KEY,
+ rule_id INTEGER REFERENCES rules(id) ON DELETE CASCADE,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ event text NOT NULL,
+ status text NOT NULL,
+ changes jsonb NOT NULL DEFAULT '[]',
+ error text,
+ due_at TIMESTAMP,
+ created_at TIMESTAMP NOT NULL,
+ CHECK (status IN ('success', 'failed', 'skipped'))
+);
+
+CREATE INDEX rule_runs_rule ON rule_runs (rule_id, created_at);
+
+CREATE UNIQUE INDEX rule_runs_due ON rule_runs (rule_id, task_id, due_at) WHERE due_at IS NOT NULL;
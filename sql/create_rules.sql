@@ -0,0 +1,15 @@
+CREATE TABLE rules(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ trigger_type text NOT NULL,
+ trigger jsonb NOT NULL,
+ conditions jsonb NOT NULL,
+ actions jsonb NOT NULL,
+ active bool NOT NULL DEFAULT true,
+ created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
+
+CREATE INDEX rules_trigger ON rules (project_id, trigger_type) WHERE active;
@@ -0,0 +1,14 @@
+CREATE TABLE sprints(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ name text NOT NULL,
+ status text NOT NULL DEFAULT 'planned',
+ starts_on DATE NOT NULL,
+ ends_on DATE NOT NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP,
+ CHECK (status IN ('planned', 'active', 'closed')),
+ CHECK (ends_on >= starts_on)
+);
+
+CREATE UNIQUE INDEX sprints_one_active ON sprints (project_id) WHERE status = 'active';
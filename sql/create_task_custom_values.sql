@@ -0,0 +1,9 @@
+CREATE TABLE task_custom_values(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ field_id INTEGER REFERENCES custom_fields(id) ON DELETE CASCADE,
+ value jsonb NOT NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP,
+ UNIQUE (task_id, field_id)
+);
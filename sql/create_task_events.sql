@@ -0,0 +1,11 @@
+CREATE TABLE task_events(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ field text NOT NULL,
+ old_value jsonb,
+ new_value jsonb,
+ created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX task_events_task ON task_events (task_id, created_at);
@@ -0,0 +1,7 @@
+CREATE TABLE task_labels(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ label_id INTEGER REFERENCES labels(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ UNIQUE (task_id, label_id)
+);
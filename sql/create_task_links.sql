@@ -0,0 +1,9 @@
+CREATE TABLE task_links(
+ id serial PRIMARY KEY,
+ source_task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ target_task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ kind text NOT NULL,
+ created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ created_at TIMESTAMP NOT NULL,
+ UNIQUE (source_task_id, target_task_id, kind)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE task_watchers(
+ id serial PRIMARY KEY,
+ task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+ created_at TIMESTAMP NOT NULL,
+ UNIQUE (task_id, user_id)
+);
@@ -1,10 +1,21 @@
 CREATE TABLE tasks(
  id serial PRIMARY KEY,
  project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ parent_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+ sprint_id INTEGER REFERENCES sprints(id) ON DELETE SET NULL,
+ milestone_id INTEGER REFERENCES milestones(id) ON DELETE SET NULL,
  created_by INTEGER REFERENCES users(id) NOT NULL,
  updated_by INTEGER REFERENCES users(id),
  name text,
+ description text NOT NULL DEFAULT '',
  status text,
+ points INTEGER NOT NULL DEFAULT 0,
+ priority text NOT NULL DEFAULT 'none',
+ due_at TIMESTAMP,
+ archived_at TIMESTAMP,
+ deleted_at TIMESTAMP,
+ deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
  created_at TIMESTAMP NOT NULL,
- updated_at TIMESTAMP
+ updated_at TIMESTAMP,
+ CHECK (priority IN ('none', 'low', 'medium', 'high', 'urgent'))
 );
@@ -0,0 +1,19 @@
+CREATE TABLE webhook_deliveries(
+ id serial PRIMARY KEY,
+ webhook_id INTEGER REFERENCES webhooks(id) ON DELETE CASCADE,
+ event text NOT NULL,
+ payload jsonb NOT NULL,
+ status text NOT NULL DEFAULT 'pending',
+ attempts INTEGER NOT NULL DEFAULT 0,
+ next_attempt_at TIMESTAMP,
+ response_status INTEGER,
+ response_body text,
+ error text,
+ delivered_at TIMESTAMP,
+ created_at TIMESTAMP NOT NULL,
+ CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE INDEX webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at);
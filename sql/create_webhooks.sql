@@ -0,0 +1,11 @@
+CREATE TABLE webhooks(
+ id serial PRIMARY KEY,
+ project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+ url text NOT NULL,
+ events jsonb NOT NULL,
+ secret text NOT NULL,
+ active bool NOT NULL DEFAULT true,
+ created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ created_at TIMESTAMP NOT NULL,
+ updated_at TIMESTAMP
+);
@@ -0,0 +1 @@
+DELETE FROM activity_feeds WHERE id = $1;
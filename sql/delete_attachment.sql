@@ -0,0 +1 @@
+DELETE FROM attachments WHERE id = $1;
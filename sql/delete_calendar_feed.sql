@@ -0,0 +1 @@
+DELETE FROM calendar_feeds WHERE id = $1 AND user_id = $2;
@@ -0,0 +1 @@
+DELETE FROM chat_links WHERE team_id = $1 AND chat_user_id = $2;
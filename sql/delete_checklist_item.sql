@@ -0,0 +1 @@
+DELETE FROM checklist_items WHERE id = $1;
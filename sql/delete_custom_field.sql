@@ -0,0 +1 @@
+DELETE FROM custom_fields WHERE id = $1;
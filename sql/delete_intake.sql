@@ -0,0 +1 @@
+DELETE FROM intakes WHERE id = $1;
@@ -0,0 +1 @@
+DELETE FROM labels WHERE id = $1;
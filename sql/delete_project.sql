@@ -1 +1 @@
-DELETE FROM projects WHERE id = $1;
+UPDATE projects SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL;
@@ -0,0 +1 @@
+DELETE FROM project_watchers WHERE project_id = $1 AND user_id = $2;
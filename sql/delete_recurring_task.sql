@@ -0,0 +1 @@
+DELETE FROM recurring_tasks WHERE id = $1;
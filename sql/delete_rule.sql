@@ -0,0 +1 @@
+DELETE FROM rules WHERE id = $1;
@@ -0,0 +1,6 @@
+WITH removed AS (
+ DELETE FROM task_assignees WHERE task_id = $1 AND ($2::integer IS NULL OR user_id = $2) RETURNING user_id
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT DISTINCT $1::integer, $3::integer, 'assignee', to_jsonb(removed.user_id), NULL::jsonb, NOW() FROM removed
+RETURNING (old_value #>> '{}')::integer;
@@ -0,0 +1 @@
+DELETE FROM sprints WHERE id = $1;
@@ -1 +1,10 @@
-DELETE FROM tasks WHERE id = $1;
+WITH RECURSIVE subtree AS (
+ SELECT id FROM tasks WHERE id = $1 AND deleted_at IS NULL
+ UNION
+ SELECT tasks.id FROM tasks JOIN subtree ON tasks.parent_id = subtree.id WHERE tasks.deleted_at IS NULL
+), deleted AS (
+ UPDATE tasks SET deleted_at = NOW(), deleted_by = $2, updated_by = $2, updated_at = NOW() WHERE id IN (SELECT id FROM subtree)
+ RETURNING id
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT id, $2, 'deleted', 'false', 'true', NOW() FROM deleted;
@@ -0,0 +1,7 @@
+WITH removed AS (
+ DELETE FROM task_custom_values WHERE task_id = $1 AND field_id = $2 RETURNING value
+), touched AS (
+ UPDATE tasks SET updated_by = $3, updated_at = NOW() WHERE id = $1 AND EXISTS (SELECT * FROM removed)
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT $1, $3, 'custom-field:' || $2::text, removed.value, NULL, NOW() FROM removed;
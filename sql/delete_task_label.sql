@@ -0,0 +1,5 @@
+WITH removed AS (
+ DELETE FROM task_labels WHERE task_id = $1 AND label_id = $2 RETURNING label_id
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT $1, $3, 'label', to_jsonb(removed.label_id), NULL, NOW() FROM removed;
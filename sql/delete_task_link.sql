@@ -0,0 +1 @@
+DELETE FROM task_links WHERE id = $1;
@@ -0,0 +1 @@
+DELETE FROM task_watchers WHERE task_id = $1 AND user_id = $2;
@@ -0,0 +1,4 @@
+SELECT id, name FROM projects
+WHERE deleted_at IS NULL AND (id::text = $1 OR lower(name) = lower($1))
+ORDER BY id
+LIMIT 2;
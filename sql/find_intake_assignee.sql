@@ -0,0 +1,4 @@
+SELECT users.id FROM users LEFT JOIN email_settings ON email_settings.user_id = users.id
+WHERE lower(email_settings.email) = lower($1)
+ OR lower(regexp_replace(users.name, '\s', '', 'g')) = lower(regexp_replace($1, '\s', '', 'g'))
+ORDER BY email_settings.email IS NULL, users.id LIMIT 1;
@@ -0,0 +1,6 @@
+SELECT id, project_id, name, color FROM labels
+WHERE project_id = $1 AND (
+ lower(name) IN (SELECT lower(jsonb_array_elements_text($2::jsonb)))
+ OR id IN (SELECT jsonb_array_elements_text($3::jsonb)::integer)
+)
+ORDER BY id;
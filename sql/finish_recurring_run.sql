@@ -0,0 +1 @@
+UPDATE recurring_tasks SET last_task_id = COALESCE($2, last_task_id), last_run_at = $3, next_run_at = $4 WHERE id = $1;
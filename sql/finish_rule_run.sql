@@ -0,0 +1 @@
+UPDATE rule_runs SET changes = $2 WHERE id = $1;
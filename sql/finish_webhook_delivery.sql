@@ -0,0 +1,4 @@
+UPDATE webhook_deliveries
+SET status = $2, next_attempt_at = $3, response_status = $4, response_body = $5, error = $6,
+ delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() END
+WHERE id = $1;
@@ -0,0 +1 @@
+SELECT id, project_id, token, created_by FROM activity_feeds WHERE id = $1;
@@ -0,0 +1,4 @@
+SELECT projects.id, projects.name
+FROM activity_feeds
+JOIN projects ON projects.id = activity_feeds.project_id
+WHERE activity_feeds.token = $1 AND projects.deleted_at IS NULL;
@@ -0,0 +1 @@
+SELECT id, project_id, name, columns, filter, group_by, created_by FROM boards WHERE id = $1;
@@ -0,0 +1,6 @@
+SELECT calendar_feeds.user_id, users.name, calendar_feeds.project_id, projects.name
+FROM calendar_feeds
+JOIN users ON users.id = calendar_feeds.user_id
+LEFT JOIN projects ON projects.id = calendar_feeds.project_id
+WHERE calendar_feeds.token = $1
+ AND (calendar_feeds.project_id IS NULL OR projects.deleted_at IS NULL);
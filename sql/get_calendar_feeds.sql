@@ -0,0 +1 @@
+SELECT id, project_id, token FROM calendar_feeds WHERE user_id = $1 ORDER BY id;
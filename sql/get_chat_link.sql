@@ -0,0 +1 @@
+SELECT user_id FROM chat_links WHERE team_id = $1 AND chat_user_id = $2;
@@ -0,0 +1 @@
+SELECT COALESCE(name, ''), COALESCE(status, '') FROM tasks WHERE id = $1 AND deleted_at IS NULL;
@@ -0,0 +1,10 @@
+SELECT tasks.id, COALESCE(tasks.name, ''), COALESCE(tasks.status, ''), tasks.due_at, projects.name
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+WHERE EXISTS (SELECT 1 FROM task_assignees WHERE task_assignees.task_id = tasks.id AND task_assignees.user_id = $1)
+ AND tasks.status <> 'Done'
+ AND tasks.deleted_at IS NULL
+ AND tasks.archived_at IS NULL
+ AND projects.deleted_at IS NULL
+ORDER BY tasks.due_at NULLS LAST, tasks.id
+LIMIT $2;
@@ -0,0 +1 @@
+SELECT task_id FROM checklist_items WHERE id = $1;
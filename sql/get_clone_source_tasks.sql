@@ -0,0 +1 @@
+SELECT id, name, description, status, priority, points, archived_at IS NOT NULL FROM tasks WHERE project_id = $1 AND deleted_at IS NULL ORDER BY id;
@@ -0,0 +1 @@
+SELECT id, task_id, parent_id, author_id, body, created_at, updated_at FROM comments WHERE id = $1;
@@ -0,0 +1 @@
+SELECT id, comment_id, edited_by, body, created_at FROM comment_revisions WHERE comment_id = $1 ORDER BY created_at, id;
@@ -0,0 +1 @@
+SELECT id, project_id, name, kind, options FROM custom_fields WHERE id = $1;
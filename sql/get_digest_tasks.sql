@@ -0,0 +1,11 @@
+SELECT tasks.id, tasks.name, tasks.status, tasks.due_at, projects.id, projects.name
+FROM tasks
+JOIN task_assignees ON task_assignees.task_id = tasks.id
+JOIN projects ON projects.id = tasks.project_id
+WHERE task_assignees.user_id = $1
+ AND tasks.due_at <= $2
+ AND tasks.status <> 'Done'
+ AND tasks.deleted_at IS NULL
+ AND tasks.archived_at IS NULL
+ AND projects.deleted_at IS NULL
+ORDER BY tasks.due_at, tasks.id;
@@ -0,0 +1,5 @@
+SELECT recurring_tasks.id
+FROM recurring_tasks
+JOIN projects ON projects.id = recurring_tasks.project_id
+WHERE recurring_tasks.next_run_at <= $1 AND projects.deleted_at IS NULL AND projects.archived_at IS NULL AND NOT projects.is_template
+ORDER BY recurring_tasks.next_run_at;
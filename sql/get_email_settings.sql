@@ -0,0 +1 @@
+SELECT email, assignments, mentions, digest FROM email_settings WHERE user_id = $1;
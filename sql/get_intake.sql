@@ -0,0 +1 @@
+SELECT id, project_id, name, token, mapping, active, created_by FROM intakes WHERE id = $1;
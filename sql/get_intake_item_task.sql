@@ -0,0 +1 @@
+SELECT task_id FROM intake_items WHERE intake_id = $1 AND external_id = $2;
@@ -0,0 +1 @@
+SELECT project_id FROM labels WHERE id = $1;
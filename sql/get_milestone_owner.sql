@@ -0,0 +1 @@
+SELECT created_by FROM milestones WHERE id = $1;
@@ -0,0 +1,5 @@
+SELECT tasks.id, tasks.name, tasks.status, tasks.points, projects.id, projects.name
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.milestone_id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+ORDER BY projects.name, tasks.id;
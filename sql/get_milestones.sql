@@ -0,0 +1,11 @@
+SELECT milestones.id, milestones.name, milestones.description, milestones.target_date, milestones.created_by,
+ COUNT(tasks.id) FILTER (WHERE tasks.status = 'Done'),
+ COUNT(tasks.id),
+ COALESCE(SUM(tasks.points) FILTER (WHERE tasks.status = 'Done'), 0),
+ COALESCE(SUM(tasks.points), 0)
+FROM milestones
+LEFT JOIN (tasks JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL)
+ ON tasks.milestone_id = milestones.id AND tasks.deleted_at IS NULL
+WHERE ($1::integer IS NULL OR milestones.id = $1)
+GROUP BY milestones.id
+ORDER BY milestones.target_date, milestones.id;
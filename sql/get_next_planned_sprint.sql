@@ -0,0 +1 @@
+SELECT id FROM sprints WHERE project_id = $1 AND status = 'planned' AND id <> $2 ORDER BY starts_on, id LIMIT 1;
@@ -0,0 +1,9 @@
+SELECT notifications.id, notifications.kind, notifications.task_id, tasks.name, notifications.comment_id,
+ notifications.actor_id, notifications.data, notifications.read_at IS NOT NULL, notifications.created_at
+FROM notifications
+JOIN tasks ON tasks.id = notifications.task_id
+WHERE notifications.user_id = $1
+ AND tasks.deleted_at IS NULL
+ AND (NOT $2::boolean OR notifications.read_at IS NULL)
+ORDER BY notifications.created_at DESC, notifications.id DESC
+LIMIT $3 OFFSET $4;
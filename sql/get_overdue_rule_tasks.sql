@@ -0,0 +1,17 @@
+SELECT rules.id, tasks.id, tasks.due_at
+FROM rules
+JOIN projects ON projects.id = rules.project_id
+JOIN tasks ON tasks.project_id = rules.project_id
+WHERE rules.active
+ AND rules.trigger_type = 'due-date-passed'
+ AND tasks.due_at <= $1
+ AND tasks.due_at > rules.created_at
+ AND tasks.status <> 'Done'
+ AND tasks.deleted_at IS NULL
+ AND tasks.archived_at IS NULL
+ AND projects.deleted_at IS NULL
+ AND NOT EXISTS (
+  SELECT 1 FROM rule_runs WHERE rule_runs.rule_id = rules.id AND rule_runs.task_id = tasks.id AND rule_runs.due_at = tasks.due_at
+ )
+ORDER BY tasks.due_at
+LIMIT $2;
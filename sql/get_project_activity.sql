@@ -0,0 +1,25 @@
+SELECT * FROM (
+ SELECT 'created' AS kind, tasks.id AS id, tasks.id AS task_id, COALESCE(tasks.name, '') AS task_name,
+  tasks.created_at AS at, actors.name AS actor_name, NULL AS previous, NULL AS detail
+ FROM tasks
+ LEFT JOIN users AS actors ON actors.id = tasks.created_by
+ WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL
+ UNION ALL
+ SELECT CASE WHEN task_events.field = 'status' THEN 'moved' ELSE 'assigned' END, task_events.id, tasks.id, COALESCE(tasks.name, ''),
+  task_events.created_at, actors.name, task_events.old_value #>> '{}',
+  CASE WHEN task_events.field = 'status' THEN task_events.new_value #>> '{}' ELSE assignees.name END
+ FROM task_events
+ JOIN tasks ON tasks.id = task_events.task_id
+ LEFT JOIN users AS actors ON actors.id = task_events.user_id
+ LEFT JOIN users AS assignees ON assignees.id = CASE WHEN task_events.field = 'assignee' THEN (task_events.new_value #>> '{}')::integer END
+ WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL
+  AND (task_events.field = 'status' OR (task_events.field = 'assignee' AND task_events.new_value IS NOT NULL))
+ UNION ALL
+ SELECT 'commented', comments.id, tasks.id, COALESCE(tasks.name, ''), comments.created_at, actors.name, NULL, comments.body
+ FROM comments
+ JOIN tasks ON tasks.id = comments.task_id
+ LEFT JOIN users AS actors ON actors.id = comments.author_id
+ WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL
+) AS activity
+ORDER BY at DESC, id DESC
+LIMIT $2;
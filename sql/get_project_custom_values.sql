@@ -0,0 +1,5 @@
+SELECT task_custom_values.task_id, task_custom_values.field_id, task_custom_values.value
+FROM task_custom_values
+JOIN tasks ON tasks.id = task_custom_values.task_id
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL;
@@ -0,0 +1 @@
+SELECT id, project_id, name, token, mapping, active, created_by FROM intakes WHERE project_id = $1 ORDER BY id;
@@ -0,0 +1 @@
+SELECT id, project_id, name, color FROM labels WHERE project_id = $1 ORDER BY name;
@@ -0,0 +1,5 @@
+SELECT DISTINCT milestones.id, milestones.name, milestones.target_date
+FROM milestones
+JOIN tasks ON tasks.milestone_id = milestones.id
+WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL
+ORDER BY milestones.target_date, milestones.id;
@@ -1 +1,4 @@
-SELECT project_id, user_id FROM project_owners WHERE project_id = $1;
+SELECT project_owners.project_id, project_owners.user_id
+FROM project_owners
+JOIN projects ON projects.id = project_owners.project_id
+WHERE project_owners.project_id = $1 AND projects.deleted_at IS NULL;
@@ -0,0 +1 @@
+SELECT id, project_id, name, schedule, starts_at, skip_if_open, priority, points, label_ids, assignee_ids, custom_fields, next_run_at, last_run_at, last_task_id, created_by FROM recurring_tasks WHERE project_id = $1 ORDER BY id;
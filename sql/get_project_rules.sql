@@ -0,0 +1 @@
+SELECT id, project_id, name, trigger, conditions, actions, active, created_by FROM rules WHERE project_id = $1 ORDER BY id;
@@ -0,0 +1 @@
+SELECT id, block_parent_done, block_blocked_start FROM projects WHERE id = $1;
@@ -0,0 +1 @@
+SELECT id, project_id, name, status, starts_on, ends_on FROM sprints WHERE project_id = $1 ORDER BY starts_on, id;
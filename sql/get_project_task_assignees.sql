@@ -0,0 +1,7 @@
+SELECT task_assignees.task_id, users.id, users.name
+FROM task_assignees
+JOIN users ON users.id = task_assignees.user_id
+JOIN tasks ON tasks.id = task_assignees.task_id
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+ORDER BY users.name, users.id;
@@ -0,0 +1,7 @@
+SELECT task_labels.task_id, labels.id, labels.project_id, labels.name, labels.color
+FROM task_labels
+JOIN labels ON labels.id = task_labels.label_id
+JOIN tasks ON tasks.id = task_labels.task_id
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.project_id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+ORDER BY labels.name;
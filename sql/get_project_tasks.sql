@@ -1 +1,14 @@
-SELECT id, name, status from tasks WHERE project_id = $1;
+SELECT tasks.id, tasks.name, tasks.description, tasks.status, tasks.parent_id, tasks.sprint_id, tasks.milestone_id, tasks.points, tasks.priority, tasks.due_at,
+ (SELECT COUNT(*) FROM tasks AS children WHERE children.parent_id = tasks.id AND children.status = 'Done' AND children.deleted_at IS NULL),
+ (SELECT COUNT(*) FROM tasks AS children WHERE children.parent_id = tasks.id AND children.deleted_at IS NULL),
+ EXISTS (SELECT * FROM task_links JOIN tasks AS blocker ON blocker.id = task_links.source_task_id
+  WHERE task_links.target_task_id = tasks.id AND task_links.kind = 'blocks' AND blocker.status <> 'Done' AND blocker.deleted_at IS NULL),
+ tasks.archived_at IS NOT NULL
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.project_id = $1
+ AND tasks.deleted_at IS NULL
+ AND projects.deleted_at IS NULL
+ AND ($4::boolean OR tasks.archived_at IS NULL)
+ AND ($2::integer IS NULL OR EXISTS (SELECT * FROM task_labels WHERE task_labels.task_id = tasks.id AND task_labels.label_id = $2))
+ AND ($3::integer IS NULL OR tasks.sprint_id = $3);
@@ -0,0 +1 @@
+SELECT id, name, created_by FROM projects WHERE is_template AND deleted_at IS NULL ORDER BY name, id;
@@ -0,0 +1 @@
+SELECT deleted_at IS NOT NULL FROM projects WHERE id = $1;
@@ -0,0 +1 @@
+SELECT user_id FROM project_watchers WHERE project_id = $1 ORDER BY user_id;
@@ -1 +1 @@
-SELECT id, name, created_by FROM projects;
+SELECT id, name, created_by, archived_at IS NOT NULL FROM projects WHERE deleted_at IS NULL AND NOT is_template AND ($1::boolean OR archived_at IS NULL);
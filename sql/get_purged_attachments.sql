@@ -0,0 +1,5 @@
+SELECT attachments.storage_key
+FROM attachments
+JOIN tasks ON tasks.id = attachments.task_id
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.deleted_at < $1 OR projects.deleted_at < $1;
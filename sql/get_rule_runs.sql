@@ -0,0 +1,5 @@
+SELECT id, rule_id, task_id, event, status, changes, error, due_at, created_at
+FROM rule_runs
+WHERE rule_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;
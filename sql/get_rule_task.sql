@@ -0,0 +1,4 @@
+SELECT tasks.status, tasks.priority, tasks.deleted_at IS NOT NULL OR tasks.archived_at IS NOT NULL,
+ COALESCE((SELECT jsonb_agg(label_id) FROM task_labels WHERE task_id = tasks.id), '[]'),
+ COALESCE((SELECT jsonb_agg(DISTINCT user_id) FROM task_assignees WHERE task_id = tasks.id), '[]')
+FROM tasks WHERE tasks.id = $1;
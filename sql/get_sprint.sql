@@ -0,0 +1 @@
+SELECT id, project_id, name, status, starts_on, ends_on FROM sprints WHERE id = $1;
@@ -0,0 +1,12 @@
+SELECT * FROM (
+ SELECT 'created' AS kind, 0 AS id, tasks.created_at AS at, tasks.created_by AS user_id, NULL AS field, NULL::jsonb AS old_value, NULL::jsonb AS new_value, NULL AS body
+ FROM tasks WHERE tasks.id = $1
+ UNION ALL
+ SELECT CASE WHEN field = 'assignee' THEN 'assignment' ELSE 'change' END, id, created_at, user_id, field, old_value, new_value, NULL
+ FROM task_events WHERE task_id = $1
+ UNION ALL
+ SELECT 'comment', id, created_at, author_id, NULL, NULL, NULL, body
+ FROM comments WHERE task_id = $1
+) AS activity
+ORDER BY at, kind, id
+LIMIT $2 OFFSET $3;
@@ -1 +1,4 @@
-SELECT task_id, user_id FROM task_assignees WHERE task_id = $1;
+SELECT task_assignees.task_id, task_assignees.user_id
+FROM task_assignees
+JOIN tasks ON tasks.id = task_assignees.task_id
+WHERE task_assignees.task_id = $1 AND tasks.deleted_at IS NULL;
@@ -0,0 +1 @@
+SELECT id, task_id, uploaded_by, filename, content_type, size, storage_key, created_at FROM attachments WHERE task_id = $1 ORDER BY created_at, id;
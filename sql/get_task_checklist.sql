@@ -0,0 +1 @@
+SELECT id, task_id, text, done, position FROM checklist_items WHERE task_id = $1 ORDER BY position, id;
@@ -0,0 +1,12 @@
+WITH RECURSIVE page AS (
+ SELECT id, task_id, parent_id, author_id, body, created_at, updated_at FROM comments
+ WHERE task_id = $1 AND parent_id IS NULL
+ ORDER BY created_at, id
+ LIMIT $2 OFFSET $3
+), thread AS (
+ SELECT * FROM page
+ UNION ALL
+ SELECT comments.id, comments.task_id, comments.parent_id, comments.author_id, comments.body, comments.created_at, comments.updated_at
+ FROM comments JOIN thread ON comments.parent_id = thread.id
+)
+SELECT id, task_id, parent_id, author_id, body, created_at, updated_at FROM thread ORDER BY created_at, id;
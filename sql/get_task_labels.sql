@@ -0,0 +1,5 @@
+SELECT labels.id, labels.project_id, labels.name, labels.color
+FROM task_labels
+JOIN labels ON labels.id = task_labels.label_id
+WHERE task_labels.task_id = $1
+ORDER BY labels.name;
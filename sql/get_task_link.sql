@@ -0,0 +1 @@
+SELECT id, source_task_id, target_task_id, kind FROM task_links WHERE id = $1;
@@ -0,0 +1,5 @@
+SELECT task_links.id, task_links.source_task_id, task_links.target_task_id, task_links.kind, other.name, other.status
+FROM task_links
+JOIN tasks AS other ON other.id = CASE WHEN task_links.source_task_id = $1 THEN task_links.target_task_id ELSE task_links.source_task_id END
+WHERE (task_links.source_task_id = $1 OR task_links.target_task_id = $1) AND other.deleted_at IS NULL
+ORDER BY task_links.id;
@@ -0,0 +1,5 @@
+SELECT tasks.deleted_at IS NOT NULL, projects.deleted_at IS NOT NULL, COALESCE(parent.deleted_at IS NOT NULL, false)
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+LEFT JOIN tasks AS parent ON parent.id = tasks.parent_id
+WHERE tasks.id = $1;
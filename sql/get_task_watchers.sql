@@ -0,0 +1,11 @@
+SELECT task_watchers.user_id, 'task' FROM task_watchers
+JOIN tasks ON tasks.id = task_watchers.task_id
+JOIN projects ON projects.id = tasks.project_id
+WHERE task_watchers.task_id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+UNION ALL
+SELECT project_watchers.user_id, 'project' FROM project_watchers
+JOIN tasks ON tasks.project_id = project_watchers.project_id
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+ AND NOT EXISTS (SELECT * FROM task_watchers WHERE task_watchers.task_id = $1 AND task_watchers.user_id = project_watchers.user_id)
+ORDER BY 1;
@@ -0,0 +1,12 @@
+SELECT 'project', projects.id, projects.name, projects.id, projects.deleted_at, projects.deleted_by
+FROM projects
+WHERE projects.deleted_at IS NOT NULL AND ($1::integer IS NULL OR projects.id = $1)
+UNION ALL
+SELECT 'task', tasks.id, tasks.name, tasks.project_id, tasks.deleted_at, tasks.deleted_by
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+LEFT JOIN tasks AS parent ON parent.id = tasks.parent_id
+WHERE tasks.deleted_at IS NOT NULL AND projects.deleted_at IS NULL
+ AND (parent.id IS NULL OR parent.deleted_at IS NULL)
+ AND ($1::integer IS NULL OR tasks.project_id = $1)
+ORDER BY 5 DESC;
@@ -0,0 +1,11 @@
+SELECT tasks.id, COALESCE(tasks.name, ''), tasks.description, COALESCE(tasks.status, ''), tasks.due_at,
+ COALESCE(tasks.updated_at, tasks.created_at), projects.id, projects.name,
+ (SELECT COUNT(*) FROM task_events WHERE task_events.task_id = tasks.id)
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+WHERE EXISTS (SELECT 1 FROM task_assignees WHERE task_assignees.task_id = tasks.id AND task_assignees.user_id = $1)
+ AND tasks.due_at IS NOT NULL
+ AND tasks.deleted_at IS NULL
+ AND tasks.archived_at IS NULL
+ AND projects.deleted_at IS NULL
+ORDER BY tasks.due_at, tasks.id;
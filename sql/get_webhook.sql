@@ -0,0 +1 @@
+SELECT id, project_id, url, events, secret, active, created_by FROM webhooks WHERE id = $1;
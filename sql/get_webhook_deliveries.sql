@@ -0,0 +1,5 @@
+SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, response_body, error, delivered_at, created_at
+FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;
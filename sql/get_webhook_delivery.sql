@@ -0,0 +1,3 @@
+SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, response_body, error, delivered_at, created_at
+FROM webhook_deliveries
+WHERE id = $1;
@@ -0,0 +1 @@
+SELECT pg_advisory_xact_lock_shared(hashtext('task_links.blocks'));
@@ -0,0 +1,4 @@
+SELECT parent.id FROM tasks
+JOIN tasks AS parent ON parent.id = tasks.parent_id
+WHERE tasks.id = $1
+FOR SHARE OF parent;
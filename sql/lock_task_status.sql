@@ -0,0 +1,4 @@
+SELECT tasks.project_id FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+WHERE tasks.id = $1 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+FOR UPDATE OF tasks;
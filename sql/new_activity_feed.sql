@@ -0,0 +1 @@
+INSERT INTO activity_feeds (project_id, token, created_by, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id;
@@ -0,0 +1 @@
+INSERT INTO attachments (task_id, uploaded_by, filename, content_type, size, storage_key, created_at) VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING id, created_at;
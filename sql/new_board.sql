@@ -0,0 +1 @@
+INSERT INTO boards (project_id, name, columns, filter, group_by, created_by, created_at) VALUES ($1, $2, $3::jsonb, $4::jsonb, $5, $6, NOW()) RETURNING id;
@@ -0,0 +1 @@
+INSERT INTO calendar_feeds (user_id, project_id, token, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id;
@@ -0,0 +1 @@
+INSERT INTO chat_link_codes (code, user_id, expires_at, created_at) VALUES ($1, $2, $3, NOW());
@@ -0,0 +1,5 @@
+INSERT INTO checklist_items (task_id, text, done, position, created_at) VALUES (
+ $1, $2, false,
+ (SELECT COALESCE(MAX(position) + 1, 0) FROM checklist_items WHERE task_id = $1),
+ NOW()
+) RETURNING id, position;
@@ -0,0 +1 @@
+INSERT INTO comments (task_id, parent_id, author_id, body, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id, created_at;
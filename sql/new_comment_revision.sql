@@ -0,0 +1,2 @@
+INSERT INTO comment_revisions (comment_id, edited_by, body, created_at)
+SELECT id, $2, body, NOW() FROM comments WHERE id = $1;
@@ -0,0 +1 @@
+INSERT INTO custom_fields (project_id, name, kind, options, created_at) VALUES ($1, $2, $3, $4::jsonb, NOW()) RETURNING id;
@@ -0,0 +1,16 @@
+INSERT INTO notifications (user_id, kind, task_id, data, created_at)
+SELECT DISTINCT project_owners.user_id, 'escalation', tasks.id,
+ jsonb_build_object(
+  'due-at', tasks.due_at,
+  'assignees', COALESCE((SELECT jsonb_agg(DISTINCT user_id) FROM task_assignees WHERE task_assignees.task_id = tasks.id), '[]')
+ ),
+ NOW()
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+JOIN project_owners ON project_owners.project_id = tasks.project_id
+WHERE tasks.due_at <= $1
+ AND tasks.status <> 'Done'
+ AND tasks.deleted_at IS NULL
+ AND tasks.archived_at IS NULL
+ AND projects.deleted_at IS NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+INSERT INTO intakes (project_id, name, token, mapping, active, created_by, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING id;
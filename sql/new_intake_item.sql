@@ -0,0 +1,2 @@
+INSERT INTO intake_items (intake_id, external_id, created_at) VALUES ($1, $2, NOW())
+ON CONFLICT (intake_id, external_id) DO NOTHING RETURNING id;
@@ -0,0 +1 @@
+INSERT INTO labels (project_id, name, color, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id;
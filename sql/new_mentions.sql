@@ -0,0 +1,14 @@
+WITH mentioned AS (
+ SELECT id FROM users
+ WHERE lower(regexp_replace(name, '\s', '', 'g')) IN (SELECT jsonb_array_elements_text($4::jsonb))
+), recorded AS (
+ INSERT INTO mentions (task_id, comment_id, user_id, mentioned_by, created_at)
+ SELECT $1, $2, id, $3, NOW() FROM mentioned
+ ON CONFLICT DO NOTHING
+ RETURNING user_id
+), watching AS (
+ INSERT INTO task_watchers (task_id, user_id, created_at)
+ SELECT $1, id, NOW() FROM mentioned
+ ON CONFLICT DO NOTHING
+)
+SELECT user_id FROM recorded ORDER BY user_id;
@@ -0,0 +1 @@
+INSERT INTO milestones (name, description, target_date, created_by, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id;
@@ -0,0 +1,17 @@
+INSERT INTO notifications (user_id, kind, task_id, data, created_at)
+SELECT DISTINCT recipients.user_id, 'overdue', tasks.id, jsonb_build_object('due-at', tasks.due_at), NOW()
+FROM tasks
+JOIN projects ON projects.id = tasks.project_id
+JOIN LATERAL (
+ SELECT user_id FROM task_assignees WHERE task_assignees.task_id = tasks.id
+ UNION
+ SELECT user_id FROM task_watchers WHERE task_watchers.task_id = tasks.id
+ UNION
+ SELECT user_id FROM project_watchers WHERE project_watchers.project_id = tasks.project_id
+) AS recipients ON true
+WHERE tasks.due_at <= $1
+ AND tasks.status <> 'Done'
+ AND tasks.deleted_at IS NULL
+ AND tasks.archived_at IS NULL
+ AND projects.deleted_at IS NULL
+ON CONFLICT DO NOTHING;
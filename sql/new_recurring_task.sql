@@ -0,0 +1,2 @@
+INSERT INTO recurring_tasks (project_id, name, schedule, starts_at, skip_if_open, priority, points, label_ids, assignee_ids, custom_fields, next_run_at, created_by, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9::jsonb, $10::jsonb, $11, $12, NOW()) RETURNING id;
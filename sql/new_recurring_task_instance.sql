@@ -0,0 +1,7 @@
+INSERT INTO tasks (name, status, project_id, created_by, priority, points, created_at)
+SELECT recurring_tasks.name, $2, recurring_tasks.project_id, COALESCE(recurring_tasks.created_by, projects.created_by),
+ recurring_tasks.priority, recurring_tasks.points, NOW()
+FROM recurring_tasks
+JOIN projects ON projects.id = recurring_tasks.project_id
+WHERE recurring_tasks.id = $1
+RETURNING id, created_by;
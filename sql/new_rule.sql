@@ -0,0 +1,2 @@
+INSERT INTO rules (project_id, name, trigger_type, trigger, conditions, actions, active, created_by, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW()) RETURNING id;
@@ -0,0 +1,3 @@
+INSERT INTO rule_runs (rule_id, task_id, event, status, error, due_at, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW())
+ON CONFLICT DO NOTHING RETURNING id;
@@ -0,0 +1 @@
+INSERT INTO sprints (project_id, name, status, starts_on, ends_on, created_at) VALUES ($1, $2, 'planned', $3, $4, NOW()) RETURNING id;
@@ -1 +1 @@
-INSERT INTO tasks (name, status, project_id, created_by, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id;
+INSERT INTO tasks (name, description, status, project_id, created_by, parent_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING id;
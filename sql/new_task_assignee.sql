@@ -1 +1,5 @@
-INSERT INTO task_assignees (user_id, task_id, created_at) VALUES ($1, $2, NOW());
+WITH added AS (
+ INSERT INTO task_assignees (user_id, task_id, created_at) VALUES ($1, $2, NOW()) RETURNING user_id
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT $2, $3, 'assignee', NULL, to_jsonb(added.user_id), NOW() FROM added;
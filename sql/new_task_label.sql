@@ -0,0 +1,6 @@
+WITH added AS (
+ INSERT INTO task_labels (task_id, label_id, created_at) VALUES ($1, $2, NOW()) ON CONFLICT (task_id, label_id) DO NOTHING
+ RETURNING label_id
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT $1, $3, 'label', NULL, to_jsonb(added.label_id), NOW() FROM added;
@@ -0,0 +1 @@
+INSERT INTO task_links (source_task_id, target_task_id, kind, created_by, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id;
@@ -0,0 +1,16 @@
+INSERT INTO notifications (user_id, kind, task_id, comment_id, actor_id, data, created_at)
+SELECT recipients.user_id, $1, $2, $3, $4, $5::jsonb, NOW() FROM (
+ SELECT user_id FROM task_assignees WHERE task_id = $2
+ UNION
+ SELECT user_id FROM task_watchers WHERE task_id = $2
+ UNION
+ SELECT project_watchers.user_id FROM project_watchers
+ JOIN tasks ON tasks.project_id = project_watchers.project_id
+ WHERE tasks.id = $2
+) AS recipients
+WHERE recipients.user_id IS DISTINCT FROM $4
+ AND recipients.user_id NOT IN (SELECT jsonb_array_elements_text($6::jsonb)::integer)
+ AND EXISTS (
+  SELECT * FROM tasks JOIN projects ON projects.id = tasks.project_id
+  WHERE tasks.id = $2 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+ );
@@ -0,0 +1 @@
+INSERT INTO task_watchers (task_id, user_id, created_at) VALUES ($1, $2, NOW()) ON CONFLICT DO NOTHING;
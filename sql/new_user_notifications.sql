@@ -0,0 +1,8 @@
+INSERT INTO notifications (user_id, kind, task_id, comment_id, actor_id, data, created_at)
+SELECT users.id, $1, $2, $3, $4, $5::jsonb, NOW() FROM users
+WHERE users.id IN (SELECT jsonb_array_elements_text($6::jsonb)::integer)
+ AND users.id IS DISTINCT FROM $4
+ AND EXISTS (
+  SELECT * FROM tasks JOIN projects ON projects.id = tasks.project_id
+  WHERE tasks.id = $2 AND tasks.deleted_at IS NULL AND projects.deleted_at IS NULL
+ );
@@ -0,0 +1,2 @@
+INSERT INTO webhooks (project_id, url, events, secret, active, created_by, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING id;
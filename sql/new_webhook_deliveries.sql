@@ -0,0 +1,3 @@
+INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at)
+SELECT id, $2, $3, NOW(), NOW() FROM webhooks
+WHERE project_id = $1 AND active AND events ? $2;
@@ -0,0 +1 @@
+SELECT pg_notify($1, $2);
@@ -0,0 +1 @@
+DELETE FROM projects WHERE deleted_at < $1;
@@ -0,0 +1 @@
+DELETE FROM tasks WHERE deleted_at < $1;
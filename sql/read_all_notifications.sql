@@ -0,0 +1 @@
+UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL;
@@ -0,0 +1,3 @@
+INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at)
+SELECT webhook_id, event, payload, NOW(), NOW() FROM webhook_deliveries WHERE id = $1
+RETURNING id;
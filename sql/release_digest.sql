@@ -0,0 +1 @@
+UPDATE email_settings SET digest_sent_at = $3 WHERE user_id = $1 AND digest_sent_at = $2;
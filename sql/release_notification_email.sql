@@ -0,0 +1 @@
+UPDATE notifications SET emailed_at = NULL WHERE id = $1 AND emailed_at = $2;
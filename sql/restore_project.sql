@@ -0,0 +1 @@
+UPDATE projects SET deleted_at = NULL, deleted_by = NULL WHERE id = $1;
@@ -0,0 +1,10 @@
+WITH RECURSIVE subtree AS (
+ SELECT id, deleted_at FROM tasks WHERE id = $1 AND deleted_at IS NOT NULL
+ UNION
+ SELECT tasks.id, tasks.deleted_at FROM tasks JOIN subtree ON tasks.parent_id = subtree.id WHERE tasks.deleted_at = subtree.deleted_at
+), restored AS (
+ UPDATE tasks SET deleted_at = NULL, deleted_by = NULL, updated_by = $2, updated_at = NOW() WHERE id IN (SELECT id FROM subtree)
+ RETURNING id
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT id, $2, 'deleted', 'true', 'false', NOW() FROM restored;
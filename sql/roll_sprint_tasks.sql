@@ -0,0 +1,8 @@
+WITH previous AS (
+ SELECT id, sprint_id AS value FROM tasks WHERE sprint_id = $1 AND status <> 'Done' AND deleted_at IS NULL FOR UPDATE
+), updated AS (
+ UPDATE tasks SET sprint_id = $2, updated_by = $3, updated_at = NOW() FROM previous WHERE tasks.id = previous.id
+ RETURNING tasks.id, previous.value AS old_value, tasks.sprint_id AS new_value
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT id, $3, 'sprint-id', to_jsonb(old_value), to_jsonb(new_value), NOW() FROM updated;
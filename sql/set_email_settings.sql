@@ -0,0 +1,4 @@
+INSERT INTO email_settings (user_id, email, assignments, mentions, digest, unsubscribe_token, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET email = $2, assignments = $3, mentions = $4, digest = $5, updated_at = NOW();
@@ -0,0 +1,12 @@
+WITH previous AS (
+ SELECT value FROM task_custom_values WHERE task_id = $1 AND field_id = $2
+), saved AS (
+ INSERT INTO task_custom_values (task_id, field_id, value, created_at) VALUES ($1, $2, $3::jsonb, NOW())
+ ON CONFLICT (task_id, field_id) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+ RETURNING value
+), touched AS (
+ UPDATE tasks SET updated_by = $4, updated_at = NOW() WHERE id = $1
+)
+INSERT INTO task_events (task_id, user_id, field, old_value, new_value, created_at)
+SELECT $1, $4, 'custom-field:' || $2::text, (SELECT value FROM previous), saved.value, NOW() FROM saved
+WHERE (SELECT value FROM previous) IS DISTINCT FROM saved.value;
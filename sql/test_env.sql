@@ -2,5 +2,34 @@
 \i sql/create_login.sql
 \i sql/create_projects.sql
 \i sql/create_project_owners.sql
+\i sql/create_sprints.sql
+\i sql/create_milestones.sql
 \i sql/create_tasks.sql
+\i sql/create_task_events.sql
 \i sql/create_task_assignees.sql
+\i sql/create_labels.sql
+\i sql/create_task_labels.sql
+\i sql/create_comments.sql
+\i sql/create_comment_revisions.sql
+\i sql/create_task_watchers.sql
+\i sql/create_project_watchers.sql
+\i sql/create_mentions.sql
+\i sql/create_notifications.sql
+\i sql/create_email_settings.sql
+\i sql/create_attachments.sql
+\i sql/create_checklist_items.sql
+\i sql/create_task_links.sql
+\i sql/create_custom_fields.sql
+\i sql/create_task_custom_values.sql
+\i sql/create_boards.sql
+\i sql/create_recurring_tasks.sql
+\i sql/create_webhooks.sql
+\i sql/create_webhook_deliveries.sql
+\i sql/create_intakes.sql
+\i sql/create_intake_items.sql
+\i sql/create_rules.sql
+\i sql/create_rule_runs.sql
+\i sql/create_calendar_feeds.sql
+\i sql/create_activity_feeds.sql
+\i sql/create_chat_links.sql
+\i sql/create_chat_link_codes.sql
@@ -0,0 +1,6 @@
+UPDATE email_settings
+SET assignments = assignments AND $2 NOT IN ('assignments', 'all'),
+ mentions = mentions AND $2 NOT IN ('mentions', 'all'),
+ digest = digest AND $2 NOT IN ('digest', 'all'),
+ updated_at = NOW()
+WHERE unsubscribe_token = $1;
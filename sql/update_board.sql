@@ -0,0 +1 @@
+UPDATE boards SET name = $2, columns = $3::jsonb, filter = $4::jsonb, group_by = $5, updated_at = NOW() WHERE id = $1;
@@ -0,0 +1 @@
+UPDATE checklist_items SET text = $2, done = $3, position = $4, updated_at = NOW() WHERE id = $1;
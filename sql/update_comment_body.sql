@@ -0,0 +1 @@
+UPDATE comments SET body = $2, updated_at = NOW() WHERE id = $1 RETURNING task_id;
@@ -0,0 +1 @@
+UPDATE custom_fields SET name = $2, options = $3::jsonb, updated_at = NOW() WHERE id = $1;
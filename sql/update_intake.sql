@@ -0,0 +1 @@
+UPDATE intakes SET name = $2, token = $3, mapping = $4, active = $5, updated_at = NOW() WHERE id = $1;
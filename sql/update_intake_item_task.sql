@@ -0,0 +1 @@
+UPDATE intake_items SET task_id = $2 WHERE id = $1;
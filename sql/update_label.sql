@@ -0,0 +1 @@
+UPDATE labels SET name = $2, color = $3, updated_at = NOW() WHERE id = $1;
@@ -0,0 +1 @@
+UPDATE milestones SET name = $2, description = $3, target_date = $4, updated_at = NOW() WHERE id = $1;
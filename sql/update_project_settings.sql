@@ -0,0 +1 @@
+UPDATE projects SET block_parent_done = $2, block_blocked_start = $3, updated_at = NOW() WHERE id = $1;
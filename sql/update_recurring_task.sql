@@ -0,0 +1,3 @@
+UPDATE recurring_tasks SET name = $2, schedule = $3, starts_at = $4, skip_if_open = $5, priority = $6, points = $7,
+ label_ids = $8::jsonb, assignee_ids = $9::jsonb, custom_fields = $10::jsonb, next_run_at = $11, updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1 @@
+UPDATE rules SET name = $2, trigger_type = $3, trigger = $4, conditions = $5, actions = $6, active = $7, updated_at = NOW() WHERE id = $1;
@@ -0,0 +1 @@
+UPDATE sprints SET name = $2, starts_on = $3, ends_on = $4, updated_at = NOW() WHERE id = $1;
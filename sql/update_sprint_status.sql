@@ -0,0 +1 @@
+UPDATE sprints SET status = $2, updated_at = NOW() WHERE id = $1;
@@ -0,0 +1 @@
+UPDATE webhooks SET url = $2, events = $3, secret = $4, active = $5, updated_at = NOW() WHERE id = $1;
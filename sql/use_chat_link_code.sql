@@ -0,0 +1,7 @@
+WITH used AS (
+ DELETE FROM chat_link_codes WHERE code = $1 AND expires_at > $2 RETURNING user_id
+)
+INSERT INTO chat_links (team_id, chat_user_id, user_id, created_at)
+SELECT $3, $4, used.user_id, NOW() FROM used
+ON CONFLICT (team_id, chat_user_id) DO UPDATE SET user_id = EXCLUDED.user_id, created_at = NOW()
+RETURNING user_id;
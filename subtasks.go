@@ -0,0 +1,189 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+)
+
+type TaskParent struct {
+	Id int64 `json:"id"`
+	ParentId *int64 `json:"parent-id"`
+}
+
+var checkTaskAncestorQuery *sql.Stmt = prepareQuery("sql/check_task_ancestor.sql")
+
+func updateTaskParentHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_task_parent.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var tp TaskParent
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&tp)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "update",
+			ActiveUserId: auId,
+			TaskId: &tp.Id,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		if tp.ParentId != nil {
+			var projectId, parentProjectId int64
+
+			err := taskProjectQuery.QueryRow(tp.Id).Scan(&projectId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Task does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			err = taskProjectQuery.QueryRow(*tp.ParentId).Scan(&parentProjectId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Parent task does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if projectId != parentProjectId {
+				http.Error(w, "Parent task belongs to a different project", 400)
+				return
+			}
+
+			// The new parent can not be the task itself or one of its subtasks.
+			var cycle bool
+			err = checkTaskAncestorQuery.QueryRow(*tp.ParentId, tp.Id).Scan(&cycle)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if cycle {
+				http.Error(w, "A task can not be a subtask of itself or its subtasks", 400)
+				return
+			}
+		}
+
+		_, dberr := stmt.Exec(tp.Id, tp.ParentId, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", tp.Id, auId, &Change{"parent-id", tp.ParentId})
+	}
+}
+
+func getTaskSubtasksHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_task_subtasks.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		id, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		var projectId int64
+		err = taskProjectQuery.QueryRow(id).Scan(&projectId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(query, id)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		tasks := make(Tasks, 0)
+
+		for rows.Next() {
+			task, err := scanTask(rows)
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			tasks = append(tasks, task)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		err = decorateTasks(projectId, tasks)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&tasks)
+	}
+}
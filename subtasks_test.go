@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"encoding/json"
+	"net/http/httptest"
+	"bytes"
+	"io/ioutil"
+	"strconv"
+)
+
+func postHandler(t *testing.T, handler http.HandlerFunc, v interface{}) (int, []byte) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	res, _ := json.Marshal(v)
+	resp, err := http.Post(server.URL, "application/json", bytes.NewBuffer(res))
+
+	if err != nil {
+		t.Fatal("Request failed with:", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, body
+}
+
+func newSubtask(t *testing.T, user *User, parent *Task) (*Task) {
+	status, body := postHandler(t, newTaskHandler(), &NewTask{Name: "sub", CreatedBy: user.Id, ProjectId: parent.ProjectId, ParentId: &parent.Id})
+
+	if status != 200 {
+		t.Fatal("New subtask has error", string(body))
+	}
+
+	var task Task
+	err := json.Unmarshal(body, &task)
+	if err != nil {
+		t.Fatal("Decoding subtask failed: ", err.Error())
+	}
+
+	return &task
+}
+
+func moveTaskTo(t *testing.T, task *Task, status string) (int) {
+	code, _ := postHandler(t, updateTaskStatusHandler(), &Task{Id: task.Id, Status: status})
+	return code
+}
+
+func getTaskChecklist(t *testing.T, task *Task) (Checklist) {
+	server := httptest.NewServer(http.HandlerFunc(getTaskChecklistHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?taskid=" + strconv.FormatInt(task.Id, 10))
+
+	if err != nil {
+		t.Fatal("Get checklist failed with", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		t.Fatal("Get checklist has error", string(body))
+	}
+
+	var checklist Checklist
+	err = json.NewDecoder(resp.Body).Decode(&checklist)
+	if err != nil {
+		t.Fatal("Decoding checklist failed", err.Error())
+	}
+
+	return checklist
+}
+
+func TestIntegrationSubtasks(t *testing.T) {
+	user := newUser(t)
+	project := newProject(t, user)
+	parent := newTask(t, user, project)
+
+	first := newSubtask(t, user, parent)
+	newSubtask(t, user, parent)
+
+	if moveTaskTo(t, first, "Done") != 200 {
+		t.Fatal("Moving a subtask to Done failed")
+	}
+
+	for _, task := range getProjectTasks(t, project) {
+		if task.Id == parent.Id && (task.Progress.Done != 1 || task.Progress.Total != 2) {
+			t.Fatal("Parent progress should be 1 of 2, but it is", task.Progress)
+		}
+	}
+
+	// Parent done rule
+
+	status, body := postHandler(t, updateProjectSettingsHandler(), &ProjectSettings{ProjectId: project.Id, BlockParentDone: true})
+	if status != 200 {
+		t.Fatal("Update project settings has error", string(body))
+	}
+
+	if code := moveTaskTo(t, parent, "Done"); code != 409 {
+		t.Fatal("A parent with an open subtask should not move to Done, got", code)
+	}
+
+	if code := moveTaskTo(t, &Task{Id: -1}, "Done"); code != 404 {
+		t.Fatal("Moving a task that does not exist should be 404, got", code)
+	}
+
+	// Checklist order
+
+	for _, text := range []string{"one", "two", "three"} {
+		status, body := postHandler(t, newChecklistItemHandler(), &ChecklistItem{TaskId: parent.Id, Text: text})
+		if status != 200 {
+			t.Fatal("New checklist item has error", string(body))
+		}
+	}
+
+	checklist := getTaskChecklist(t, parent)
+	if len(checklist) != 3 || checklist[0].Text != "one" || checklist[2].Position != 2 {
+		t.Fatal("Checklist items should keep the order they were added in, got", checklist)
+	}
+
+	last := checklist[2]
+	last.Position = -1
+
+	status, body = postHandler(t, updateChecklistItemHandler(), &last)
+	if status != 200 {
+		t.Fatal("Update checklist item has error", string(body))
+	}
+
+	checklist = getTaskChecklist(t, parent)
+	if checklist[0].Text != "three" || checklist[1].Text != "one" {
+		t.Fatal("A checklist item moved to the front should be listed first, got", checklist)
+	}
+}
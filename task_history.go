@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// TaskActivity is one entry of a task's timeline. Kind is created, change,
+// assignment or comment. Changes and assignments carry the field with its
+// old and new value, null when the field was unset. Comments carry their id
+// and body.
+type TaskActivity struct {
+	Kind string `json:"kind"`
+	Id int64 `json:"id"`
+	At time.Time `json:"at"`
+	UserId *int64 `json:"user-id"`
+	Field string `json:"field,omitempty"`
+	OldValue json.RawMessage `json:"old-value,omitempty"`
+	NewValue json.RawMessage `json:"new-value,omitempty"`
+	Body string `json:"body,omitempty"`
+}
+
+type TaskActivities []TaskActivity
+
+type TaskActivityPage struct {
+	Activity TaskActivities `json:"activity"`
+	Total int64 `json:"total"`
+	Limit int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+// rawOrNull keeps a nullable jsonb column as json, turning SQL NULL into json null.
+func rawOrNull(v []byte) (json.RawMessage) {
+	if v == nil {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(v)
+}
+
+// getTaskActivityHandler pages through a task's timeline oldest first,
+// interleaving field changes, assignments and comments.
+func getTaskActivityHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_task_activity.sql")
+	countQuery := loadQuery("sql/count_task_activity.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		taskId, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		limit, offset, err := pagination(q)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		page := &TaskActivityPage{Limit: limit, Offset: offset}
+
+		err = db.QueryRow(countQuery, taskId).Scan(&page.Total)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(query, taskId, limit, offset)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		page.Activity = make(TaskActivities, 0)
+
+		for rows.Next() {
+			a := TaskActivity{}
+			var userId sql.NullInt64
+			var field, body sql.NullString
+			var oldValue, newValue []byte
+
+			err := rows.Scan(&a.Kind, &a.Id, &a.At, &userId, &field, &oldValue, &newValue, &body)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if userId.Valid {
+				id := userId.Int64
+				a.UserId = &id
+			}
+
+			if field.Valid {
+				a.Field = field.String
+				a.OldValue = rawOrNull(oldValue)
+				a.NewValue = rawOrNull(newValue)
+			}
+
+			a.Body = body.String
+
+			page.Activity = append(page.Activity, a)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(page)
+	}
+}
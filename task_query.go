@@ -0,0 +1,447 @@
+package main
+
+import (
+	"errors"
+	"encoding/json"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TaskQuery selects and orders the tasks of a project. Label and sprint
+// filters run in the database, the remaining filters and sorting run on the
+// loaded tasks since custom field values are typed per project. LabelIds and
+// AssigneeIds keep tasks with any of the listed labels or assignees. Archived
+// tasks are left out unless Archived is set.
+type TaskQuery struct {
+	Id int64 `json:"id"`
+	LabelId *int64 `json:"label-id"`
+	SprintId *int64 `json:"sprint-id"`
+	LabelIds []int64 `json:"label-ids"`
+	AssigneeIds []int64 `json:"assignee-ids"`
+	Archived bool `json:"archived"`
+	Fields []FieldFilter `json:"fields"`
+	Sort *TaskSort `json:"sort"`
+}
+
+// FieldFilter compares a custom field with Value. Op is one of eq, neq, lt,
+// lte, gt, gte, contains, set or empty.
+type FieldFilter struct {
+	FieldId int64 `json:"field-id"`
+	Op string `json:"op"`
+	Value json.RawMessage `json:"value"`
+}
+
+// TaskSort orders tasks by a custom field when FieldId is set, otherwise by
+// one of the id, name, status or points columns named in By.
+type TaskSort struct {
+	By string `json:"by"`
+	FieldId int64 `json:"field-id"`
+	Desc bool `json:"desc"`
+}
+
+var fieldFilterOps = map[string]set{
+	"text": toSet([]string{"eq", "neq", "contains", "set", "empty"}),
+	"number": toSet([]string{"eq", "neq", "lt", "lte", "gt", "gte", "set", "empty"}),
+	"date": toSet([]string{"eq", "neq", "lt", "lte", "gt", "gte", "set", "empty"}),
+	"single-select": toSet([]string{"eq", "neq", "set", "empty"}),
+	"multi-select": toSet([]string{"eq", "neq", "contains", "set", "empty"}),
+	"user": toSet([]string{"eq", "neq", "set", "empty"}),
+}
+
+var taskSortColumns = toSet([]string{"id", "name", "status", "points"})
+
+// normalizeFieldFilter checks a filter against its field and re-encodes the
+// compared value. Multi-select filters compare against a single option.
+func normalizeFieldFilter(f *CustomField, ff *FieldFilter) error {
+	if !fieldFilterOps[f.Kind].Has(ff.Op) {
+		return errors.New("Filter op " + ff.Op + " can not be used on " + f.Kind + " field " + f.Name)
+	}
+
+	if ff.Op == "set" || ff.Op == "empty" {
+		return nil
+	}
+
+	if f.Kind == "multi-select" {
+		option := &CustomField{Name: f.Name, Kind: "single-select", Options: f.Options}
+		value, err := normalizeCustomValue(option, ff.Value)
+		if err != nil {
+			return err
+		}
+		ff.Value = value
+		return nil
+	}
+
+	if f.Kind == "text" && ff.Op == "contains" {
+		var v string
+		if json.Unmarshal(ff.Value, &v) != nil {
+			return errors.New(f.Name + " must be compared with a string")
+		}
+		return nil
+	}
+
+	value, err := normalizeCustomValue(f, ff.Value)
+	if err != nil {
+		return err
+	}
+
+	ff.Value = value
+	return nil
+}
+
+func decodeCustomValue(v json.RawMessage) (interface{}) {
+	var d interface{}
+	json.Unmarshal(v, &d)
+	return d
+}
+
+// compareCustomValues orders two values of the same field. Text compares
+// without case and multi-select values compare by their joined options.
+func compareCustomValues(a, b json.RawMessage) (int) {
+	va := decodeCustomValue(a)
+	vb := decodeCustomValue(b)
+
+	switch x := va.(type) {
+	case float64:
+		y, _ := vb.(float64)
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+		return 0
+	case string:
+		y, _ := vb.(string)
+		return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+	case []interface{}:
+		y, _ := vb.([]interface{})
+		return strings.Compare(joinOptions(x), joinOptions(y))
+	}
+
+	return 0
+}
+
+func joinOptions(v []interface{}) (string) {
+	options := make([]string, 0, len(v))
+	for _, o := range v {
+		s, _ := o.(string)
+		options = append(options, s)
+	}
+	return strings.Join(options, ",")
+}
+
+func multiSelectHas(value, option json.RawMessage) (bool) {
+	var values []string
+	var o string
+	json.Unmarshal(value, &values)
+	json.Unmarshal(option, &o)
+
+	for _, v := range values {
+		if v == o {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFieldFilter reports whether a task's value for a field, nil when the
+// task has none, passes a normalized filter.
+func matchFieldFilter(kind string, value json.RawMessage, ff *FieldFilter) (bool) {
+	switch ff.Op {
+	case "set":
+		return value != nil
+	case "empty":
+		return value == nil
+	case "neq":
+		return value == nil || !matchFieldFilter(kind, value, &FieldFilter{FieldId: ff.FieldId, Op: "eq", Value: ff.Value})
+	}
+
+	if value == nil {
+		return false
+	}
+
+	if kind == "multi-select" {
+		return multiSelectHas(value, ff.Value)
+	}
+
+	if ff.Op == "contains" {
+		var v, sub string
+		json.Unmarshal(value, &v)
+		json.Unmarshal(ff.Value, &sub)
+		return strings.Contains(strings.ToLower(v), strings.ToLower(sub))
+	}
+
+	c := compareCustomValues(value, ff.Value)
+
+	switch ff.Op {
+	case "eq":
+		return c == 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	}
+
+	return false
+}
+
+func filterTasks(tasks Tasks, fields map[int64]CustomField, filters []FieldFilter) (Tasks) {
+	if len(filters) == 0 {
+		return tasks
+	}
+
+	filtered := make(Tasks, 0, len(tasks))
+
+	for _, task := range tasks {
+		keep := true
+
+		for i := range filters {
+			ff := &filters[i]
+			if !matchFieldFilter(fields[ff.FieldId].Kind, task.CustomFields[ff.FieldId], ff) {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			filtered = append(filtered, task)
+		}
+	}
+
+	return filtered
+}
+
+func hasAny(ids []int64, wanted set) (bool) {
+	for _, id := range ids {
+		if wanted.Has(strconv.FormatInt(id, 10)) {
+			return true
+		}
+	}
+	return false
+}
+
+func idSet(ids []int64) (set) {
+	s := make(set)
+	for _, id := range ids {
+		s.Add(strconv.FormatInt(id, 10))
+	}
+	return s
+}
+
+// filterTaskMembers keeps the tasks carrying one of labelIds and assigned to
+// one of assigneeIds. An empty list does not filter.
+func filterTaskMembers(tasks Tasks, labelIds []int64, assigneeIds []int64) (Tasks) {
+	if len(labelIds) == 0 && len(assigneeIds) == 0 {
+		return tasks
+	}
+
+	labels := idSet(labelIds)
+	assignees := idSet(assigneeIds)
+
+	filtered := make(Tasks, 0, len(tasks))
+
+	for _, task := range tasks {
+		if len(labelIds) > 0 {
+			taskLabels := make([]int64, 0, len(task.Labels))
+			for _, l := range task.Labels {
+				taskLabels = append(taskLabels, l.Id)
+			}
+
+			if !hasAny(taskLabels, labels) {
+				continue
+			}
+		}
+
+		if len(assigneeIds) > 0 && !hasAny(task.Assignees, assignees) {
+			continue
+		}
+
+		filtered = append(filtered, task)
+	}
+
+	return filtered
+}
+
+// sortTasks orders tasks in place. Tasks without a value for the sorted
+// custom field always come last.
+func sortTasks(tasks Tasks, ts *TaskSort) {
+	if ts == nil {
+		return
+	}
+
+	less := func(a, b *Task) (int, bool) {
+		if ts.FieldId != 0 {
+			va, vb := a.CustomFields[ts.FieldId], b.CustomFields[ts.FieldId]
+			if va == nil || vb == nil {
+				return 0, false
+			}
+			return compareCustomValues(va, vb), true
+		}
+
+		switch ts.By {
+		case "name":
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), true
+		case "status":
+			return strings.Compare(a.Status, b.Status), true
+		case "points":
+			return int(a.Points - b.Points), true
+		}
+
+		return int(a.Id - b.Id), true
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := &tasks[i], &tasks[j]
+
+		c, ok := less(a, b)
+		if !ok {
+			va := a.CustomFields[ts.FieldId]
+			vb := b.CustomFields[ts.FieldId]
+			return va != nil && vb == nil
+		}
+
+		if ts.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// decorateTasks adds the labels, assignees and custom field values of a
+// project to tasks loaded from it.
+func decorateTasks(projectId int64, tasks Tasks) (error) {
+	taskLabels, err := projectTaskLabels(projectId)
+	if err != nil {
+		return err
+	}
+
+	assignees, err := projectTaskAssignees(projectId)
+	if err != nil {
+		return err
+	}
+
+	values, err := projectCustomValues(projectId)
+	if err != nil {
+		return err
+	}
+
+	for i := range tasks {
+		tasks[i].ProjectId = projectId
+
+		if labels, ok := taskLabels[tasks[i].Id]; ok {
+			tasks[i].Labels = labels
+		}
+
+		for _, u := range assignees[tasks[i].Id] {
+			tasks[i].Assignees = append(tasks[i].Assignees, u.Id)
+		}
+
+		if v, ok := values[tasks[i].Id]; ok {
+			tasks[i].CustomFields = v
+		}
+	}
+
+	return nil
+}
+
+var projectTasksQuery *sql.Stmt = prepareQuery("sql/get_project_tasks.sql")
+
+// queryError marks a problem with the query itself rather than with loading tasks.
+type queryError struct {
+	message string
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+// checkTaskQuery validates the custom field filters and sort of a query
+// against the fields of its project and normalizes the filter values. It
+// returns the project fields by id when the query uses any.
+func checkTaskQuery(tq *TaskQuery) (map[int64]CustomField, error) {
+	var fields map[int64]CustomField
+
+	if len(tq.Fields) > 0 || (tq.Sort != nil && tq.Sort.FieldId != 0) {
+		projectFields, err := projectCustomFields(tq.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		fields = make(map[int64]CustomField)
+		for _, f := range projectFields {
+			fields[f.Id] = f
+		}
+	}
+
+	for i := range tq.Fields {
+		f, ok := fields[tq.Fields[i].FieldId]
+		if !ok {
+			return nil, &queryError{"Custom field " + strconv.FormatInt(tq.Fields[i].FieldId, 10) + " does not belong to the project"}
+		}
+
+		err := normalizeFieldFilter(&f, &tq.Fields[i])
+		if err != nil {
+			return nil, &queryError{err.Error()}
+		}
+	}
+
+	if tq.Sort != nil {
+		if tq.Sort.FieldId != 0 {
+			_, ok := fields[tq.Sort.FieldId]
+			if !ok {
+				return nil, &queryError{"Custom field " + strconv.FormatInt(tq.Sort.FieldId, 10) + " does not belong to the project"}
+			}
+		} else if !taskSortColumns.Has(tq.Sort.By) {
+			return nil, &queryError{"Tasks can only be sorted by id, name, status, points or a custom field"}
+		}
+	}
+
+	return fields, nil
+}
+
+func queryProjectTasks(tq *TaskQuery) (Tasks, error) {
+	fields, err := checkTaskQuery(tq)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := projectTasksQuery.Query(tq.Id, tq.LabelId, tq.SprintId, tq.Archived)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tasks := make(Tasks, 0)
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = decorateTasks(tq.Id, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks = filterTaskMembers(tasks, tq.LabelIds, tq.AssigneeIds)
+	tasks = filterTasks(tasks, fields, tq.Fields)
+	sortTasks(tasks, tq.Sort)
+
+	return tasks, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"encoding/json"
+)
+
+func TestNormalizeCustomValue(t *testing.T) {
+	env := &CustomField{Name: "environment", Kind: "single-select", Options: []string{"staging", "prod"}}
+
+	v, err := normalizeCustomValue(env, json.RawMessage(`"prod"`))
+	if err != nil || string(v) != `"prod"` {
+		t.Fatal("prod should be a valid environment, got", string(v), err)
+	}
+
+	_, err = normalizeCustomValue(env, json.RawMessage(`"qa"`))
+	if err == nil {
+		t.Fatal("qa is not an environment option")
+	}
+
+	tags := &CustomField{Name: "tags", Kind: "multi-select", Options: []string{"a", "b"}}
+
+	v, err = normalizeCustomValue(tags, json.RawMessage(`["b", "a", "b"]`))
+	if err != nil || string(v) != `["b","a"]` {
+		t.Fatal("Multi-select values should be deduplicated, got", string(v), err)
+	}
+
+	due := &CustomField{Name: "due", Kind: "date"}
+
+	_, err = normalizeCustomValue(due, json.RawMessage(`"19/10/2026"`))
+	if err == nil {
+		t.Fatal("Dates must use the 2006-01-02 layout")
+	}
+
+	severity := &CustomField{Name: "severity", Kind: "number"}
+
+	_, err = normalizeCustomValue(severity, json.RawMessage(`"high"`))
+	if err == nil {
+		t.Fatal("Number fields should reject strings")
+	}
+}
+
+func TestFilterAndSortTasks(t *testing.T) {
+	fields := map[int64]CustomField{
+		1: CustomField{Id: 1, Name: "severity", Kind: "number"},
+		2: CustomField{Id: 2, Name: "customer", Kind: "text"},
+	}
+
+	tasks := Tasks{
+		Task{Id: 1, CustomFields: CustomValues{1: json.RawMessage(`3`), 2: json.RawMessage(`"Acme Corp"`)}},
+		Task{Id: 2, CustomFields: CustomValues{1: json.RawMessage(`1`)}},
+		Task{Id: 3, CustomFields: CustomValues{}},
+		Task{Id: 4, CustomFields: CustomValues{1: json.RawMessage(`2`), 2: json.RawMessage(`"Globex"`)}},
+	}
+
+	filters := []FieldFilter{FieldFilter{FieldId: 1, Op: "gte", Value: json.RawMessage(`2`)}}
+	f := fields[1]
+	err := normalizeFieldFilter(&f, &filters[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered := filterTasks(tasks, fields, filters)
+	if len(filtered) != 2 || filtered[0].Id != 1 || filtered[1].Id != 4 {
+		t.Fatal("Tasks 1 and 4 have a severity of at least 2, got", filtered)
+	}
+
+	contains := []FieldFilter{FieldFilter{FieldId: 2, Op: "contains", Value: json.RawMessage(`"acme"`)}}
+	filtered = filterTasks(tasks, fields, contains)
+	if len(filtered) != 1 || filtered[0].Id != 1 {
+		t.Fatal("Only task 1 has a customer containing acme, got", filtered)
+	}
+
+	sorted := append(Tasks{}, tasks...)
+	sortTasks(sorted, &TaskSort{FieldId: 1, Desc: true})
+
+	order := []int64{1, 4, 2, 3}
+	for i, id := range order {
+		if sorted[i].Id != id {
+			t.Fatal("Sorting by severity descending should give 1, 4, 2, 3, got", sorted)
+		}
+	}
+
+	op := FieldFilter{FieldId: 2, Op: "lt", Value: json.RawMessage(`"x"`)}
+	f = fields[2]
+	err = normalizeFieldFilter(&f, &op)
+	if err == nil {
+		t.Fatal("lt should not be allowed on text fields")
+	}
+}
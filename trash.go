@@ -0,0 +1,463 @@
+package main
+
+import (
+	"log"
+	"errors"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashItem is a soft deleted project or task that can still be restored.
+// Subtasks deleted together with their parent are restored with it and are
+// not listed on their own.
+type TrashItem struct {
+	Kind string `json:"kind"`
+	Id int64 `json:"id"`
+	Name string `json:"name"`
+	ProjectId int64 `json:"project-id"`
+	DeletedAt time.Time `json:"deleted-at"`
+	DeletedBy *int64 `json:"deleted-by"`
+	PurgeAt time.Time `json:"purge-at"`
+}
+
+type TrashItems []TrashItem
+
+type ArchiveRequest struct {
+	Id int64 `json:"id"`
+	Archived bool `json:"archived"`
+}
+
+// parseRetention reads a retention period given either as a Go duration or
+// as a whole number of days like 30d.
+func parseRetention(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseInt(strings.TrimSuffix(s, "d"), 10, 64)
+		if err != nil || days < 0 {
+			return 0, errors.New("Invalid retention " + s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("Invalid retention " + s)
+	}
+	return d, nil
+}
+
+func loadRetention() (time.Duration) {
+	d, err := parseRetention(config.Trash.Retention)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return d
+}
+
+var trashRetention time.Duration = loadRetention()
+
+// archiveHandler archives or unarchives a project or task. Archived items
+// are hidden from boards and project lists but still found when asked for.
+func archiveHandler(entity string, file string) func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery(file)
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var ar ArchiveRequest
+
+		jsonerr := json.NewDecoder(r.Body).Decode(&ar)
+		if jsonerr != nil {
+			http.Error(w, jsonerr.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: entity,
+			Action: "update",
+			ActiveUserId: auId,
+		}
+
+		if entity == "project" {
+			rr.ProjectId = &ar.Id
+		} else {
+			rr.TaskId = &ar.Id
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		args := []interface{}{ar.Id, ar.Archived}
+
+		// Archiving a task is recorded in its history, projects keep none.
+		if entity == "task" {
+			args = append(args, auId)
+		}
+
+		_, dberr := stmt.Exec(args...)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		if entity == "project" {
+			publishProjectEvent("project.updated", ar.Id, auId, &Change{"archived", ar.Archived})
+		} else {
+			publishTaskEvent("task.updated", ar.Id, auId, &Change{"archived", ar.Archived})
+		}
+	}
+}
+
+// idRequest reads the id of the item to act on from the request body.
+func idRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if r.Body == nil {
+		http.Error(w, "Please send a request body", 400)
+		return 0, false
+	}
+
+	var data map[string]int64
+
+	jsonerr := json.NewDecoder(r.Body).Decode(&data)
+	if jsonerr != nil {
+		http.Error(w, jsonerr.Error(), 400)
+		return 0, false
+	}
+
+	id, ok := data["id"]
+	if !ok {
+		http.Error(w, "Please include id field with request body", 400)
+		return 0, false
+	}
+
+	return id, true
+}
+
+var projectTrashStateQuery *sql.Stmt = prepareQuery("sql/get_project_trash_state.sql")
+
+func restoreProjectHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/restore_project.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		projectId, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "project",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		var deleted bool
+		err := projectTrashStateQuery.QueryRow(projectId).Scan(&deleted)
+		if err == sql.ErrNoRows || (err == nil && !deleted) {
+			http.Error(w, "Project is not in the trash", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		_, dberr := stmt.Exec(projectId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishProjectEvent("project.updated", projectId, auId, &Change{"deleted", false})
+	}
+}
+
+var taskTrashStateQuery *sql.Stmt = prepareQuery("sql/get_task_trash_state.sql")
+
+// taskTrashed reports whether a task or its project is in the trash, where
+// the task can not be changed. A task that does not exist gives
+// sql.ErrNoRows.
+func taskTrashed(taskId int64) (bool, error) {
+	var deleted, projectDeleted, parentDeleted bool
+	err := taskTrashStateQuery.QueryRow(taskId).Scan(&deleted, &projectDeleted, &parentDeleted)
+	return deleted || projectDeleted, err
+}
+
+// restoreTaskHandler brings back a task together with the subtasks that were
+// deleted along with it.
+func restoreTaskHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/restore_task.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		taskId, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "task",
+			Action: "delete",
+			ActiveUserId: auId,
+			TaskId: &taskId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		var deleted, projectDeleted, parentDeleted bool
+		err := taskTrashStateQuery.QueryRow(taskId).Scan(&deleted, &projectDeleted, &parentDeleted)
+		if err == sql.ErrNoRows || (err == nil && !deleted) {
+			http.Error(w, "Task is not in the trash", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		if projectDeleted {
+			http.Error(w, "Restore the project of this task first", 409)
+			return
+		}
+
+		if parentDeleted {
+			http.Error(w, "Restore the parent of this task first", 409)
+			return
+		}
+
+		_, dberr := stmt.Exec(taskId, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		publishTaskEvent("task.updated", taskId, auId, &Change{"deleted", false})
+	}
+}
+
+// getTrashHandler lists the deleted projects and tasks the user may restore,
+// newest first. The optional projectid param narrows it to one project.
+func getTrashHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_trash.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		var projectId sql.NullInt64
+
+		if q["projectid"] != nil {
+			v, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+
+			projectId = sql.NullInt64{Int64: v, Valid: true}
+		}
+
+		rows, err := db.Query(query, projectId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		items := make(TrashItems, 0)
+
+		for rows.Next() {
+			item := TrashItem{}
+			var deletedBy sql.NullInt64
+
+			err := rows.Scan(&item.Kind, &item.Id, &item.Name, &item.ProjectId, &item.DeletedAt, &deletedBy)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			if deletedBy.Valid {
+				id := deletedBy.Int64
+				item.DeletedBy = &id
+			}
+
+			item.PurgeAt = item.DeletedAt.Add(trashRetention)
+
+			items = append(items, item)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		visible := make(TrashItems, 0, len(items))
+
+		for i := range items {
+			rr := &RoleRequest{
+				Entity: items[i].Kind,
+				Action: "delete",
+				ActiveUserId: auId,
+			}
+
+			if items[i].Kind == "project" {
+				rr.ProjectId = &items[i].Id
+			} else {
+				rr.TaskId = &items[i].Id
+			}
+
+			if rr.Satisfied() {
+				visible = append(visible, items[i])
+			}
+		}
+
+		json.NewEncoder(w).Encode(&visible)
+	}
+}
+
+var purgeTasksQuery string = loadQuery("sql/purge_tasks.sql")
+
+var purgeProjectsQuery string = loadQuery("sql/purge_projects.sql")
+
+var purgedAttachmentsQuery string = loadQuery("sql/get_purged_attachments.sql")
+
+// purgeTrash permanently deletes the projects and tasks deleted before the
+// cutoff and then the attachment blobs left without a row.
+func purgeTrash(before time.Time) (error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(purgedAttachmentsQuery, before)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0)
+
+	for rows.Next() {
+		var key string
+
+		err := rows.Scan(&key)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		keys = append(keys, key)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(purgeTasksQuery, before)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(purgeProjectsQuery, before)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err := blobs.Delete(key)
+		if err != nil && err != ErrBlobNotFound {
+			log.Println("Failed to delete attachment blob " + key + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// trashPurger schedules purging the trash of items older than the configured
+// retention.
+func trashPurger() {
+	err := scheduler.AddFunc(config.Trash.PurgeSchedule, func() {
+		err := purgeTrash(time.Now().Add(-trashRetention))
+		if err != nil {
+			log.Println("Failed to purge trash: " + err.Error())
+		}
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
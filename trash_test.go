@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"0d": 0,
+		"720h": 720 * time.Hour,
+		"90m": 90 * time.Minute,
+	}
+
+	for s, want := range cases {
+		d, err := parseRetention(s)
+		if err != nil {
+			t.Fatal(s, err)
+		}
+
+		if d != want {
+			t.Fatal(s, "should be", want, "got", d)
+		}
+	}
+
+	for _, s := range []string{"", "d", "-1d", "1.5d", "-2h", "week"} {
+		_, err := parseRetention(s)
+		if err == nil {
+			t.Fatal(s, "should not parse")
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"encoding/json"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Watcher is a user following a task, either directly or through its
+// project. Via is task or project.
+type Watcher struct {
+	UserId int64 `json:"user-id"`
+	Via string `json:"via"`
+}
+
+type Watchers []Watcher
+
+// queryer is satisfied by both the database and a transaction.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// A mention is @ followed by a user name with its whitespace left out, so
+// @janedoe mentions Jane Doe. Names are matched case insensitively and an @
+// inside a word, as in an email address, is not a mention.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([\w.\-]+)`)
+
+// parseMentions returns the distinct lower cased names mentioned in body.
+func parseMentions(body string) ([]string) {
+	names := make([]string, 0)
+	seen := make(set)
+
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := strings.ToLower(strings.TrimRight(m[2], ".-"))
+		if name == "" || seen.Has(name) {
+			continue
+		}
+
+		seen.Add(name)
+		names = append(names, name)
+	}
+
+	return names
+}
+
+var newMentionsQuery string = loadQuery("sql/new_mentions.sql")
+
+// recordMentions resolves the mentions in body against users, records them
+// for the task or comment and makes the mentioned users watch the task. It
+// returns the users mentioned there for the first time, so editing a text
+// does not mention the same people again.
+func recordMentions(q queryer, taskId int64, commentId *int64, body string, mentionedBy int64) ([]int64, error) {
+	names := parseMentions(body)
+	if len(names) == 0 {
+		return make([]int64, 0), nil
+	}
+
+	namesJson, _ := json.Marshal(names)
+
+	rows, err := q.Query(newMentionsQuery, taskId, commentId, mentionedBy, string(namesJson))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	userIds := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		userIds = append(userIds, id)
+	}
+
+	return userIds, rows.Err()
+}
+
+// watchHandler makes the active user start or stop watching a task or a
+// project. Anyone who can see an item may watch it.
+func watchHandler(entity string, file string) func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery(file)
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if entity == "project" {
+			var deleted bool
+			err := projectTrashStateQuery.QueryRow(id).Scan(&deleted)
+			if err == sql.ErrNoRows || (err == nil && deleted) {
+				http.Error(w, "Project does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		} else {
+			var projectId int64
+			err := taskProjectQuery.QueryRow(id).Scan(&projectId)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Task does not exist", 404)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		_, dberr := stmt.Exec(id, auId)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+var taskWatchersQuery *sql.Stmt = prepareQuery("sql/get_task_watchers.sql")
+
+// taskWatchers returns the users watching a task or its project.
+func taskWatchers(taskId int64) (Watchers, error) {
+	rows, err := taskWatchersQuery.Query(taskId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	watchers := make(Watchers, 0)
+
+	for rows.Next() {
+		wr := Watcher{}
+
+		err := rows.Scan(&wr.UserId, &wr.Via)
+		if err != nil {
+			return nil, err
+		}
+
+		watchers = append(watchers, wr)
+	}
+
+	return watchers, rows.Err()
+}
+
+func getTaskWatchersHandler() func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["taskid"] == nil {
+			http.Error(w, "taskid param is unavailable", 400)
+			return
+		}
+
+		taskId, err := strconv.ParseInt(q["taskid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		watchers, err := taskWatchers(taskId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&watchers)
+	}
+}
+
+func getProjectWatchersHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_watchers.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, _ := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		projectId, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rows, err := db.Query(query, projectId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		userIds := make([]int64, 0)
+
+		for rows.Next() {
+			var id int64
+
+			err := rows.Scan(&id)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			userIds = append(userIds, id)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&userIds)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"reflect"
+)
+
+func TestParseMentions(t *testing.T) {
+	cases := map[string][]string{
+		"": {},
+		"@shiba can you look?": {"shiba"},
+		"cc @JaneDoe, @shiba and @janedoe.": {"janedoe", "shiba"},
+		"mail jane@example.com": {},
+		"(@ricky) @@ricky": {"ricky"},
+		"@a.b-c_d": {"a.b-c_d"},
+	}
+
+	for body, want := range cases {
+		got := parseMentions(body)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatal("Mentions in", body, "should be", want, "got", got)
+		}
+	}
+}
@@ -0,0 +1,801 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"encoding/hex"
+	"encoding/json"
+	"database/sql"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Webhook posts the events of a project to URL. Each request is signed with
+// Secret, see webhookSignature. A webhook that is not active queues nothing
+// and holds its pending deliveries until it is turned back on.
+type Webhook struct {
+	Id int64 `json:"id"`
+	ProjectId int64 `json:"project-id"`
+	URL string `json:"url"`
+	Events []string `json:"events"`
+	Secret string `json:"secret"`
+	Active *bool `json:"active"`
+	CreatedBy *int64 `json:"created-by"`
+}
+
+type Webhooks []Webhook
+
+// WebhookDelivery is one attempt, or series of retries, at posting an event
+// to a webhook. Status is pending, delivered or failed.
+type WebhookDelivery struct {
+	Id int64 `json:"id"`
+	WebhookId int64 `json:"webhook-id"`
+	Event string `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+	Status string `json:"status"`
+	Attempts int64 `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next-attempt-at"`
+	ResponseStatus *int64 `json:"response-status"`
+	ResponseBody string `json:"response-body"`
+	Error string `json:"error"`
+	DeliveredAt *time.Time `json:"delivered-at"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+type WebhookDeliveries []WebhookDelivery
+
+type WebhookDeliveryPage struct {
+	Deliveries WebhookDeliveries `json:"deliveries"`
+	Total int64 `json:"total"`
+	Limit int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+// maxResponseBody is how much of a receiver's answer the delivery log keeps.
+const maxResponseBody = 1024
+
+// webhookSignature is sent as X-Kanelm-Signature-256 so receivers can check
+// a payload came from us: sha256= and the hex HMAC-SHA256 of the body keyed
+// with the webhook secret.
+func webhookSignature(secret string, body []byte) (string) {
+	return "sha256=" + hex.EncodeToString(hmacSHA256([]byte(secret), string(body)))
+}
+
+// webhookBackoff is how long to wait before retrying after the given number
+// of failed attempts: 30 seconds, doubling each time, at most 12 hours.
+func webhookBackoff(attempts int64) (time.Duration) {
+	d := 30 * time.Second
+	for i := int64(1); i < attempts; i++ {
+		d *= 2
+		if d >= 12 * time.Hour {
+			return 12 * time.Hour
+		}
+	}
+	return d
+}
+
+// publicAddress reports whether a webhook may be sent to ip. Loopback,
+// private, link-local and other non-routable addresses are refused, so a
+// webhook can not reach the server itself or the network it runs in, such as
+// a cloud metadata service.
+func publicAddress(ip net.IP) (bool) {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// webhookDialControl refuses connections to addresses that are not public.
+// It runs on the address actually dialed, after DNS resolution and for every
+// redirect, so a host name that resolves to an internal address is caught too.
+func webhookDialControl(network string, address string, c syscall.RawConn) (error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !publicAddress(ip) {
+		return errors.New("webhook address " + host + " is not public")
+	}
+
+	return nil
+}
+
+func validWebhook(wh *Webhook) (bool, string) {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false, "Webhook url must be an absolute http or https url"
+	}
+
+	ip := net.ParseIP(u.Hostname())
+	if strings.EqualFold(u.Hostname(), "localhost") || (ip != nil && !publicAddress(ip)) {
+		return false, "Webhook url must point to a public address"
+	}
+
+	if len(wh.Events) == 0 {
+		return false, "A webhook needs at least one event"
+	}
+
+	for _, e := range wh.Events {
+		if !eventTypes.Has(e) {
+			return false, "Unknown event " + e
+		}
+	}
+
+	return true, ""
+}
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	wh := Webhook{}
+	var events []byte
+	var active bool
+	var createdBy sql.NullInt64
+
+	err := row.Scan(&wh.Id, &wh.ProjectId, &wh.URL, &events, &wh.Secret, &active, &createdBy)
+	if err != nil {
+		return wh, err
+	}
+
+	wh.Active = &active
+
+	if createdBy.Valid {
+		id := createdBy.Int64
+		wh.CreatedBy = &id
+	}
+
+	err = json.Unmarshal(events, &wh.Events)
+	return wh, err
+}
+
+var getWebhookQuery *sql.Stmt = prepareQuery("sql/get_webhook.sql")
+
+func getWebhook(id int64) (*Webhook, error) {
+	wh, err := scanWebhook(getWebhookQuery.QueryRow(id))
+	if err != nil {
+		return nil, err
+	}
+	return &wh, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (WebhookDelivery, error) {
+	d := WebhookDelivery{}
+	var payload []byte
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var responseStatus sql.NullInt64
+	var responseBody, message sql.NullString
+
+	err := row.Scan(&d.Id, &d.WebhookId, &d.Event, &payload, &d.Status, &d.Attempts, &nextAttemptAt, &responseStatus, &responseBody, &message, &deliveredAt, &d.CreatedAt)
+	if err != nil {
+		return d, err
+	}
+
+	d.Payload = json.RawMessage(payload)
+	d.ResponseBody = responseBody.String
+	d.Error = message.String
+
+	if nextAttemptAt.Valid && d.Status == "pending" {
+		t := nextAttemptAt.Time
+		d.NextAttemptAt = &t
+	}
+
+	if responseStatus.Valid {
+		s := responseStatus.Int64
+		d.ResponseStatus = &s
+	}
+
+	if deliveredAt.Valid {
+		t := deliveredAt.Time
+		d.DeliveredAt = &t
+	}
+
+	return d, nil
+}
+
+var newWebhookDeliveriesQuery *sql.Stmt = prepareQuery("sql/new_webhook_deliveries.sql")
+
+// enqueueWebhooks queues a delivery of the event to every active webhook of
+// its project that subscribes to it. Sending is left to the dispatcher.
+func enqueueWebhooks(e *Event) {
+	payload, _ := json.Marshal(e)
+
+	_, err := newWebhookDeliveriesQuery.Exec(e.ProjectId, e.Type, string(payload))
+	if err != nil {
+		log.Println("Failed to queue webhooks for " + e.Type + ": " + err.Error())
+	}
+}
+
+var claimWebhookDeliveriesQuery *sql.Stmt = prepareQuery("sql/claim_webhook_deliveries.sql")
+
+var finishWebhookDeliveryQuery *sql.Stmt = prepareQuery("sql/finish_webhook_delivery.sql")
+
+// webhookBatch is how many deliveries one dispatcher run sends.
+const webhookBatch = 20
+
+type claimedDelivery struct {
+	id int64
+	event string
+	payload []byte
+	attempts int64
+	url string
+	secret string
+}
+
+// deliverWebhooks sends the deliveries that are due. Each is claimed by
+// pushing its next attempt past the request timeout, so other servers skip
+// it while it is in flight and a crash only delays it.
+func deliverWebhooks(client *http.Client, now time.Time) (error) {
+	rows, err := claimWebhookDeliveriesQuery.Query(now, now.Add(2 * client.Timeout), webhookBatch)
+	if err != nil {
+		return err
+	}
+
+	claimed := make([]claimedDelivery, 0)
+
+	for rows.Next() {
+		c := claimedDelivery{}
+
+		err := rows.Scan(&c.id, &c.event, &c.payload, &c.attempts, &c.url, &c.secret)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		claimed = append(claimed, c)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range claimed {
+		status, body, err := postWebhook(client, &c)
+
+		var responseStatus interface{}
+		if status != 0 {
+			responseStatus = status
+		}
+
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+
+		state := "delivered"
+		var nextAttemptAt interface{}
+
+		if err != nil || status < 200 || status > 299 {
+			state = "pending"
+			nextAttemptAt = time.Now().Add(webhookBackoff(c.attempts))
+
+			if c.attempts >= int64(config.Webhooks.MaxAttempts) {
+				state = "failed"
+				nextAttemptAt = nil
+			}
+		}
+
+		_, dberr := finishWebhookDeliveryQuery.Exec(c.id, state, nextAttemptAt, responseStatus, body, message)
+		if dberr != nil {
+			return dberr
+		}
+	}
+
+	return nil
+}
+
+func postWebhook(client *http.Client, c *claimedDelivery) (int, string, error) {
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(c.payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Kanelm-Webhook")
+	req.Header.Set("X-Kanelm-Event", c.event)
+	req.Header.Set("X-Kanelm-Delivery", strconv.FormatInt(c.id, 10))
+	req.Header.Set("X-Kanelm-Signature-256", webhookSignature(c.secret, c.payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+
+	return resp.StatusCode, strings.Replace(strings.ToValidUTF8(string(body), ""), "\x00", "", -1), nil
+}
+
+// webhookDispatcher queues webhook deliveries for published events and
+// schedules sending them.
+func webhookDispatcher() {
+	timeout, err := time.ParseDuration(config.Webhooks.Timeout)
+	if err != nil {
+		log.Fatal("Invalid webhook timeout " + config.Webhooks.Timeout)
+	}
+
+	// The transport connects directly, without an environment proxy, so
+	// webhookDialControl sees the receiver's address.
+	dialer := &net.Dialer{Timeout: timeout, Control: webhookDialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	client := &http.Client{Timeout: timeout, Transport: transport}
+
+	listen(enqueueWebhooks)
+
+	err = scheduler.AddFunc(config.Webhooks.Schedule, func() {
+		err := deliverWebhooks(client, time.Now())
+		if err != nil {
+			log.Println("Failed to deliver webhooks: " + err.Error())
+		}
+	})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+func newWebhookHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/new_webhook.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var wh Webhook
+
+		err := json.NewDecoder(r.Body).Decode(&wh)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "webhook",
+			Action: "insert",
+			ActiveUserId: auId,
+			ProjectId: &wh.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		ok, message = validWebhook(&wh)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if wh.Secret == "" {
+			wh.Secret, err = randomToken()
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		if wh.Active == nil {
+			active := true
+			wh.Active = &active
+		}
+
+		events, _ := json.Marshal(wh.Events)
+
+		err = stmt.QueryRow(wh.ProjectId, wh.URL, string(events), wh.Secret, *wh.Active, auId).Scan(&wh.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		wh.CreatedBy = &auId
+
+		json.NewEncoder(w).Encode(&wh)
+	}
+}
+
+// updateWebhookHandler replaces a webhook's url, events and active flag. An
+// empty secret keeps the current one.
+func updateWebhookHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/update_webhook.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "Please send a request body", 400)
+			return
+		}
+
+		var wh Webhook
+
+		err := json.NewDecoder(r.Body).Decode(&wh)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		current, err := getWebhook(wh.Id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "webhook",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &current.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		wh.ProjectId = current.ProjectId
+		wh.CreatedBy = current.CreatedBy
+
+		ok, message = validWebhook(&wh)
+		if !ok {
+			http.Error(w, message, 400)
+			return
+		}
+
+		if wh.Secret == "" {
+			wh.Secret = current.Secret
+		}
+
+		if wh.Active == nil {
+			wh.Active = current.Active
+		}
+
+		events, _ := json.Marshal(wh.Events)
+
+		_, dberr := stmt.Exec(wh.Id, wh.URL, string(events), wh.Secret, *wh.Active)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&wh)
+	}
+}
+
+func deleteWebhookHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/delete_webhook.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		wh, err := getWebhook(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "webhook",
+			Action: "delete",
+			ActiveUserId: auId,
+			ProjectId: &wh.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		_, dberr := stmt.Exec(id)
+		if dberr != nil {
+			http.Error(w, dberr.Error(), 500)
+			return
+		}
+	}
+}
+
+// getProjectWebhooksHandler lists a project's webhooks with their secrets,
+// so it is limited to the people who manage them.
+func getProjectWebhooksHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_project_webhooks.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["projectid"] == nil {
+			http.Error(w, "projectid param is unavailable", 400)
+			return
+		}
+
+		projectId, err := strconv.ParseInt(q["projectid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "webhook",
+			Action: "select",
+			ActiveUserId: auId,
+			ProjectId: &projectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		rows, err := db.Query(query, projectId)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		webhooks := make(Webhooks, 0)
+
+		for rows.Next() {
+			wh, err := scanWebhook(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			webhooks = append(webhooks, wh)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&webhooks)
+	}
+}
+
+// getWebhookDeliveriesHandler pages through the delivery log of a webhook,
+// newest first.
+func getWebhookDeliveriesHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/get_webhook_deliveries.sql")
+	countQuery := loadQuery("sql/count_webhook_deliveries.sql")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q["webhookid"] == nil {
+			http.Error(w, "webhookid param is unavailable", 400)
+			return
+		}
+
+		webhookId, err := strconv.ParseInt(q["webhookid"][0], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		limit, offset, err := pagination(q)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		wh, err := getWebhook(webhookId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "webhook",
+			Action: "select",
+			ActiveUserId: auId,
+			ProjectId: &wh.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		page := &WebhookDeliveryPage{Limit: limit, Offset: offset}
+
+		err = db.QueryRow(countQuery, webhookId).Scan(&page.Total)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rows, err := db.Query(query, webhookId, limit, offset)
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		defer rows.Close()
+
+		page.Deliveries = make(WebhookDeliveries, 0)
+
+		for rows.Next() {
+			d, err := scanWebhookDelivery(rows)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+
+			page.Deliveries = append(page.Deliveries, d)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+var getWebhookDeliveryQuery *sql.Stmt = prepareQuery("sql/get_webhook_delivery.sql")
+
+// redeliverWebhookHandler queues a new delivery of a logged delivery's
+// payload, leaving the original in the log.
+func redeliverWebhookHandler() func(http.ResponseWriter, *http.Request) {
+
+	query := loadQuery("sql/redeliver_webhook.sql")
+	stmt, err := db.Prepare(query)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, message, auId := requestAuthorized(r)
+		if !ok {
+			http.Error(w, message, 404)
+			return
+		}
+
+		id, ok := idRequest(w, r)
+		if !ok {
+			return
+		}
+
+		d, err := scanWebhookDelivery(getWebhookDeliveryQuery.QueryRow(id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Delivery does not exist", 404)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		wh, err := getWebhook(d.WebhookId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		rr := &RoleRequest{
+			Entity: "webhook",
+			Action: "update",
+			ActiveUserId: auId,
+			ProjectId: &wh.ProjectId,
+		}
+
+		if !rr.Satisfied() {
+			http.Error(w, "User role is not satisfied for this action", 404)
+			return
+		}
+
+		var newId int64
+		err = stmt.QueryRow(id).Scan(&newId)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		redelivery, err := scanWebhookDelivery(getWebhookDeliveryQuery.QueryRow(newId))
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&redelivery)
+	}
+}
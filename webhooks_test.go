@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	// Checked against openssl dgst -sha256 -hmac.
+	sig := webhookSignature("It's a Secret to Everybody", []byte("Hello, World!"))
+	if sig != "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17" {
+		t.Fatal("Unexpected signature", sig)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cases := map[int64]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		4: 4 * time.Minute,
+		20: 12 * time.Hour,
+	}
+
+	for attempts, want := range cases {
+		if got := webhookBackoff(attempts); got != want {
+			t.Fatal("Backoff after", attempts, "attempts should be", want, "got", got)
+		}
+	}
+}
+
+func TestValidWebhook(t *testing.T) {
+	ok, _ := validWebhook(&Webhook{URL: "https://ci.example.com/hook", Events: []string{"task.created", "project.updated"}})
+	if !ok {
+		t.Fatal("A https webhook with known events should be valid")
+	}
+
+	invalid := []Webhook{
+		Webhook{URL: "ftp://example.com", Events: []string{"task.created"}},
+		Webhook{URL: "/relative", Events: []string{"task.created"}},
+		Webhook{URL: "https://example.com", Events: []string{}},
+		Webhook{URL: "https://example.com", Events: []string{"task.exploded"}},
+		Webhook{URL: "http://localhost:8080/hook", Events: []string{"task.created"}},
+		Webhook{URL: "http://127.0.0.1/hook", Events: []string{"task.created"}},
+		Webhook{URL: "http://169.254.169.254/latest/meta-data", Events: []string{"task.created"}},
+		Webhook{URL: "http://[::1]/hook", Events: []string{"task.created"}},
+	}
+
+	for _, wh := range invalid {
+		if ok, _ := validWebhook(&wh); ok {
+			t.Fatal("Webhook should be invalid", wh)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	refused := []string{"127.0.0.1:80", "10.1.2.3:443", "192.168.0.10:80", "172.16.0.1:80", "169.254.169.254:80", "[::1]:443", "[fe80::1]:80", "0.0.0.0:80", "[::ffff:127.0.0.1]:80"}
+
+	for _, address := range refused {
+		if webhookDialControl("tcp", address, nil) == nil {
+			t.Fatal("Dialing", address, "should be refused")
+		}
+	}
+
+	allowed := []string{"93.184.216.34:443", "[2606:2800:220:1:248:1893:25c8:1946]:443"}
+
+	for _, address := range allowed {
+		if err := webhookDialControl("tcp", address, nil); err != nil {
+			t.Fatal("Dialing", address, "should be allowed:", err)
+		}
+	}
+}